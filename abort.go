@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// aborted is set once --max-runtime has run out.
+var aborted atomic.Bool
+
+// abortGrace is how long workers get to wind down after --max-runtime
+// before the process is stopped regardless.
+const abortGrace = time.Second
+
+// limitRuntime cancels ctx after d so that scans stop and report what they
+// have. Anything that doesn't return within abortGrace of that, such as a
+// mode that never looks at ctx, is cut off by exiting outright.
+func limitRuntime(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	context.AfterFunc(ctx, func() {
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		aborted.Store(true)
+		time.AfterFunc(abortGrace, func() {
+			fmt.Fprintf(os.Stderr, "%sError: scan aborted after %v (--max-runtime) and did not stop in time%s\n", red, d, reset)
+			os.Exit(2)
+		})
+	})
+	return ctx, cancel
+}
+
+// exitIfAborted exits with status 2 if --max-runtime ran out, after the
+// partial results have been printed.
+func exitIfAborted() {
+	if aborted.Load() {
+		fmt.Fprintf(os.Stderr, "%sError: scan aborted after %v (--max-runtime); results are partial%s\n", red, opts.maxRuntime, reset)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// alloc binds port 0 and prints the port the kernel assigned, for the
+// alloc command. Unlike scanning for a free port and hoping it stays free,
+// the kernel only hands out a port nothing else holds. The port is
+// released on exit unless hold is set. Holding it for --hold lets a caller
+// read the number and then bind the port itself, or, with --fd, take over
+// the socket.
+func alloc(hold bool) {
+	sock, port, err := bindSocket(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: could not bind an ephemeral port: %v%s\n", red, err, reset)
+		os.Exit(1)
+	}
+	defer sock.Close()
+
+	if opts.json {
+		fmt.Printf("{\"port\": %d, \"protocol\": %q}\n", port, protocol())
+	} else {
+		fmt.Println(port)
+	}
+	if opts.printFD {
+		printFD(sock)
+	}
+	if hold {
+		time.Sleep(opts.hold)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// assertPort checks one port and exits 0 if it is in the state --assert-open
+// or --assert-closed expects, 1 otherwise, saying which. Open means in use
+// locally or accepting connections on a --host; closed means available or
+// refusing. A port that could not be checked for certain, such as a remote
+// port that timed out, fails both assertions.
+func assertPort(ctx context.Context, port int, wantOpen bool) {
+	r := checkPort(ctx, port, false)
+	label := strconv.Itoa(port)
+	if r.Host != "" {
+		label = net.JoinHostPort(r.Host, label)
+	}
+	want := "closed"
+	if wantOpen {
+		want = "open"
+	}
+	status := resultStatus(r)
+	if r.Err != "" {
+		status += " (" + r.Err + ")"
+	}
+	// Anything short of a definite answer fails: an error, an unstable
+	// port, or a UDP port that may or may not be open.
+	if r.InUse == wantOpen && r.Err == "" && r.State == "" && !r.Unstable {
+		fmt.Printf("%s%s PASS%s: port %s%s%s is %s (expected %s)\n", green, symbolPass, reset, bold, label, reset, status, want)
+		os.Exit(0)
+	}
+	fmt.Printf("%s%s FAIL%s: port %s%s%s is %s (expected %s)\n", red, symbolFail, reset, bold, label, reset, status, want)
+	os.Exit(1)
+}
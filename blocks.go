@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// printBlocks prints the in-use results of a sorted scan for --blocks:
+// runs of consecutive ports held by the same program (or, without --pid,
+// simply in use) become one line such as "Ports 8000-8007 are in use
+// (8 consecutive)", and the rest are printed as usual.
+func printBlocks(results []PortResult, showPID bool) {
+	for i := 0; i < len(results); {
+		r := results[i]
+		if !r.InUse || r.Unstable {
+			if r.Unstable {
+				printResult(r, showPID)
+			}
+			i++
+			continue
+		}
+		j := i
+		for j+1 < len(results) && sameBlock(results[j], results[j+1]) {
+			j++
+		}
+		if j == i {
+			printResult(r, showPID)
+		} else {
+			printBlock(results[i:j+1], showPID)
+		}
+		i = j + 1
+	}
+}
+
+// sameBlock reports whether b continues the block a ends. Processes are
+// compared by name, as the workers of a pool each have their own PID.
+func sameBlock(a, b PortResult) bool {
+	return b.InUse && !b.Unstable && b.Port == a.Port+1 && b.Host == a.Host && b.Process == a.Process
+}
+
+func printBlock(block []PortResult, showPID bool) {
+	first, last := block[0], block[len(block)-1]
+	ports, word := fmt.Sprintf("%d-%d", first.Port, last.Port), "in use"
+	if first.Host != "" {
+		ports, word = net.JoinHostPort(first.Host, ports), "open"
+	}
+	owner := ""
+	if showPID && first.Process != "" {
+		owner = fmt.Sprintf(", Process: %s%s%s", cyan, first.Process, reset)
+	}
+	fmt.Printf("%s%s%s Ports %s%s%s are %s%s%s%s (%d consecutive%s)\n",
+		red, symbolOpen, reset, bold, ports, reset, red, bold, word, reset, len(block), owner)
+}
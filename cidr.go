@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+)
+
+// maxCIDRHosts caps how many addresses --cidr expands to, so a typo like
+// /8 doesn't queue millions of dials.
+const maxCIDRHosts = 65536
+
+// expandCIDR returns the host addresses of a network block. For IPv4
+// blocks larger than /31 the network and broadcast addresses are left out;
+// /31 point-to-point links and /32 single hosts keep every address.
+func expandCIDR(block string) ([]netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --cidr block %q", block)
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 16 {
+		return nil, fmt.Errorf("--cidr %s is too large; use a /%d or smaller block", block, prefix.Addr().BitLen()-16)
+	}
+
+	var addrs []netip.Addr
+	for a := prefix.Addr(); prefix.Contains(a) && len(addrs) < maxCIDRHosts; a = a.Next() {
+		addrs = append(addrs, a)
+	}
+	if prefix.Addr().Is4() && hostBits > 1 {
+		addrs = addrs[1 : len(addrs)-1]
+	}
+	return addrs, nil
+}
+
+// checkCIDR dials port on every host of a network block and lists the
+// hosts that accepted the connection.
+func checkCIDR(ctx context.Context, block string, port int) {
+	addrs, err := expandCIDR(block)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+	targets := make([]Target, len(addrs))
+	for i, a := range addrs {
+		targets[i] = Target{a.String(), port, "tcp"}
+	}
+
+	if !machineReadable() {
+		fmt.Printf("%sChecking port %d on %d hosts in %s...%s\n\n", cyan, port, len(targets), block, reset)
+	}
+	startTime := time.Now()
+	results := scanTargets(ctx, targets)
+	// scanTargets orders hosts as strings; put them in address order.
+	slices.SortFunc(results, func(a, b PortResult) int {
+		return netip.MustParseAddr(a.Host).Compare(netip.MustParseAddr(b.Host))
+	})
+	if machineReadable() {
+		exitReport(results, time.Since(startTime))
+	}
+
+	open := 0
+	for _, r := range results {
+		if r.InUse {
+			open++
+			printResult(r, false)
+		}
+	}
+	fmt.Printf("\n%s%s hosts checked in %s | %s with port %d open%s\n",
+		cyan, formatCount(len(results)), formatElapsed(time.Since(startTime)), formatCount(open), port, reset)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// column is a field that --columns can select for table and CSV output.
+type column struct {
+	Name  string
+	Value func(r PortResult) string
+}
+
+// allColumns lists the selectable fields, in the order --columns lists
+// them in its error message.
+var allColumns = []column{
+	{"host", func(r PortResult) string { return r.Host }},
+	{"port", func(r PortResult) string { return strconv.Itoa(r.Port) }},
+	{"protocol", func(r PortResult) string { return r.Protocol }},
+	{"in_use", func(r PortResult) string { return strconv.FormatBool(r.InUse) }},
+	{"status", resultStatus},
+	{"state", func(r PortResult) string { return r.State }},
+	{"family", func(r PortResult) string { return r.Family }},
+	{"pid", func(r PortResult) string {
+		if r.PID == 0 {
+			return ""
+		}
+		return strconv.Itoa(r.PID)
+	}},
+	{"process", func(r PortResult) string { return r.Process }},
+	{"cmdline", func(r PortResult) string { return r.Cmdline }},
+	{"service", func(r PortResult) string { return r.Service }},
+	{"owned_by_me", func(r PortResult) string { return strconv.FormatBool(r.OwnedByMe) }},
+	{"queue_len", func(r PortResult) string { return strconv.Itoa(r.QueueLen) }},
+	{"queue_max", func(r PortResult) string { return strconv.Itoa(r.QueueMax) }},
+	{"connections", func(r PortResult) string { return strconv.Itoa(r.Connections) }},
+	{"keepalive_connections", func(r PortResult) string { return strconv.Itoa(r.KeepaliveConns) }},
+	{"timer_state", func(r PortResult) string { return r.TimerState }},
+	{"error", func(r PortResult) string { return r.Err }},
+}
+
+// columnAliases are other names accepted for a column. A local check
+// tests whether the port can be bound, so "bound" is its in_use.
+var columnAliases = map[string]string{"bound": "in_use", "proto": "protocol"}
+
+// resultStatus is the word the text output uses for a result.
+func resultStatus(r PortResult) string {
+	switch {
+	case r.Unstable:
+		return "unstable"
+	case r.State == stateOpenFiltered, r.State == stateFiltered:
+		return r.State
+	case r.Tier == tierSlow:
+		return "slow"
+	case r.Host != "" && r.InUse:
+		return "open"
+	case r.Host != "":
+		return "closed"
+	case r.InUse:
+		return "in use"
+	}
+	return "available"
+}
+
+// parseColumns resolves a --columns list such as "port,status,pid".
+func parseColumns(s string) ([]column, error) {
+	var cols []column
+	for _, given := range strings.Split(s, ",") {
+		given = strings.ToLower(strings.TrimSpace(given))
+		name := given
+		if alias, ok := columnAliases[given]; ok {
+			name = alias
+		}
+		col, ok := findColumn(name)
+		if !ok {
+			names := make([]string, len(allColumns))
+			for i, c := range allColumns {
+				names[i] = c.Name
+			}
+			return nil, fmt.Errorf("unknown column %q; choose from %s", given, strings.Join(names, ", "))
+		}
+		// Headed with the name asked for, alias or not.
+		col.Name = given
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+func findColumn(name string) (column, bool) {
+	for _, c := range allColumns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// columnNames returns the header row for cols.
+func columnNames(cols []column) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// columnValues returns the row for r.
+func columnValues(cols []column, r PortResult) []string {
+	values := make([]string, len(cols))
+	for i, c := range cols {
+		values[i] = c.Value(r)
+	}
+	return values
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// compareState is one side of a --compare entry.
+type compareState struct {
+	InUse   bool   `json:"in_use"`
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+}
+
+// compareEntry is a port whose state differs from the saved report.
+type compareEntry struct {
+	Host     string       `json:"host,omitempty"`
+	Port     int          `json:"port"`
+	Protocol string       `json:"protocol"`
+	Before   compareState `json:"before"`
+	After    compareState `json:"after"`
+}
+
+// compareDiff is the drift between a saved report and a fresh check of the
+// same targets, printed by --compare-format json.
+type compareDiff struct {
+	Opened         []compareEntry `json:"opened"`
+	Closed         []compareEntry `json:"closed"`
+	ProcessChanged []compareEntry `json:"process_changed"`
+}
+
+func (d compareDiff) empty() bool {
+	return len(d.Opened) == 0 && len(d.Closed) == 0 && len(d.ProcessChanged) == 0
+}
+
+// compareScan checks the targets of a report saved with --json again and
+// prints what changed: ports that opened or closed, and, when the report
+// named processes, ports now held by a different one. It exits 1 if
+// anything changed, so it can gate on drift.
+func compareScan(ctx context.Context, path string) {
+	report, err := loadReport(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+	targets := make([]Target, len(report.Results))
+	withProcess := false
+	for i, r := range report.Results {
+		targets[i] = r.Target()
+		withProcess = withProcess || r.Process != ""
+	}
+	results := scanTargets(ctx, targets)
+	if withProcess {
+		resolveProcesses(results)
+	}
+
+	now := make(map[Target]PortResult, len(results))
+	for _, r := range results {
+		now[r.Target()] = r
+	}
+	diff := compareDiff{Opened: []compareEntry{}, Closed: []compareEntry{}, ProcessChanged: []compareEntry{}}
+	for _, before := range report.Results {
+		after, ok := now[before.Target()]
+		if !ok {
+			continue
+		}
+		e := compareEntry{
+			Host: before.Host, Port: before.Port, Protocol: before.Protocol,
+			Before: compareState{before.InUse, before.PID, before.Process},
+			After:  compareState{after.InUse, after.PID, after.Process},
+		}
+		switch {
+		case !before.InUse && after.InUse:
+			diff.Opened = append(diff.Opened, e)
+		case before.InUse && !after.InUse:
+			diff.Closed = append(diff.Closed, e)
+		case before.InUse && before.Process != "" && after.Process != before.Process:
+			diff.ProcessChanged = append(diff.ProcessChanged, e)
+		}
+	}
+
+	if opts.compareFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+			os.Exit(2)
+		}
+	} else {
+		printDiff(path, diff)
+	}
+	exitIfInterrupted()
+	if !diff.empty() {
+		os.Exit(1)
+	}
+}
+
+// printDiff prints a --compare diff for people.
+func printDiff(path string, diff compareDiff) {
+	if diff.empty() {
+		fmt.Printf("%sNo changes since %s%s\n", green, path, reset)
+		return
+	}
+	fmt.Printf("%sChanges since %s:%s\n", cyan, path, reset)
+	for _, e := range diff.Opened {
+		fmt.Printf("%s+%s %s %sopened%s%s\n", red, reset, Target{e.Host, e.Port, e.Protocol}, red, reset, formatOwner(e.After))
+	}
+	for _, e := range diff.Closed {
+		fmt.Printf("%s-%s %s %sclosed%s%s\n", green, reset, Target{e.Host, e.Port, e.Protocol}, green, reset, formatOwner(e.Before))
+	}
+	for _, e := range diff.ProcessChanged {
+		after := e.After.Process
+		if after == "" {
+			after = "unknown"
+		}
+		fmt.Printf("%s~%s %s now held by %s%s%s (was %s)\n", yellow, reset, Target{e.Host, e.Port, e.Protocol}, cyan, after, reset, e.Before.Process)
+	}
+}
+
+// formatOwner names the process of one side of a diff entry, if known.
+func formatOwner(s compareState) string {
+	if s.Process == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s, PID %d)", s.Process, s.PID)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// stateFiltered is the State of a local port that --connect could neither
+// reach nor get refused by, which on loopback usually means a firewall rule
+// is dropping the connection. Whether anything is listening is unknown.
+const stateFiltered = "filtered"
+
+// checkConnect checks a local TCP port by connecting to it on loopback
+// rather than binding it, for --connect. It answers the same question as
+// a bind: an accepted connection means the port is in use, and a refusal
+// means nothing listens there, so it is available. Anything else, such as
+// a timeout, leaves the port filtered with the error recorded.
+func checkConnect(ctx context.Context, port int, getPID bool) PortResult {
+	result := PortResult{Port: port, Protocol: "tcp"}
+	start := time.Now()
+	dialer := newDialer("tcp")
+	conn, err := dialer.DialContext(ctx, dialNetwork("tcp"), net.JoinHostPort("localhost", strconv.Itoa(port)))
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	switch {
+	case err == nil:
+		closeFromSourcePort(conn)
+		result.InUse = true
+		if getPID {
+			findProcessByPort(&result)
+			if opts.fullCommand && result.PID > 0 {
+				result.Cmdline = readCmdline(result.PID)
+			}
+		}
+	case !errors.Is(err, syscall.ECONNREFUSED):
+		result.State = stateFiltered
+		result.Err = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCheckConnect(t *testing.T) {
+	opts.portTimeout, opts.family = 2*time.Second, "4"
+	t.Cleanup(func() { opts.family = "" })
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := ln.Addr().(*net.TCPAddr).Port
+	r := checkConnect(context.Background(), open, false)
+	if !r.InUse || r.State != "" {
+		t.Errorf("listening port: in use %v, state %q, want in use", r.InUse, r.State)
+	}
+
+	ln.Close()
+	r = checkConnect(context.Background(), open, false)
+	if got := resultStatus(r); got != "available" || r.Err != "" {
+		t.Errorf("closed port: status %q, error %q, want available", got, r.Err)
+	}
+}
+
+// TestCheckConnectFiltered fills the accept queue of a listener that never
+// accepts, so the kernel drops further SYNs and the next connection times
+// out, as it would behind a DROP rule.
+func TestCheckConnectFiltered(t *testing.T) {
+	opts.portTimeout, opts.family = 200*time.Millisecond, "4"
+	t.Cleanup(func() { opts.family = "" })
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := sa.(*syscall.SockaddrInet4).Port
+
+	filled := false
+	for range 16 {
+		conn, err := net.DialTimeout("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 200*time.Millisecond)
+		if err != nil {
+			filled = true
+			break
+		}
+		defer conn.Close()
+	}
+	if !filled {
+		t.Skip("the accept queue never filled up")
+	}
+
+	r := checkConnect(context.Background(), port, false)
+	if got := resultStatus(r); got != stateFiltered || r.InUse || r.Err == "" {
+		t.Errorf("dropped port: status %q, in use %v, error %q, want filtered with an error", got, r.InUse, r.Err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runDaemon scans the targets every --interval until SIGTERM or SIGINT,
+// keeping the latest result of each and logging the ones that change, as
+// watch does for a single port. The first pass logs what is in use. With
+// --targets-json, SIGHUP re-reads the file; a file that no longer loads is
+// reported and the previous targets are kept.
+func runDaemon(ctx context.Context, portArg string, showPID bool) {
+	load := func() ([]Target, error) {
+		if opts.targetsJSON != "" {
+			targets, invalid, err := loadTargetsJSON(opts.targetsJSON)
+			if err == nil && len(invalid) > 0 {
+				err = fmt.Errorf("%d invalid entries in %s, first: %s", len(invalid), opts.targetsJSON, invalid[0])
+			}
+			return targets, err
+		}
+		ports, err := parsePortList(portArg)
+		if err != nil {
+			return nil, fmt.Errorf("%s", parseErrorMessage(err))
+		}
+		targets := make([]Target, len(ports))
+		for i, port := range ports {
+			targets[i] = Target{opts.host, port, protocol()}
+		}
+		return targets, nil
+	}
+	targets, err := load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	logf := func(format string, args ...any) {
+		fmt.Printf("%s %s%s%s\n", formatTime(time.Now()), cyan, fmt.Sprintf(format, args...), reset)
+	}
+	logf("Monitoring %d targets every %v (pid %d)", len(targets), opts.interval, os.Getpid())
+
+	latest := make(map[Target]PortResult)
+	for {
+		results := scanTargets(ctx, targets)
+		if showPID {
+			resolveProcesses(results)
+		}
+		for _, r := range results {
+			last, seen := latest[r.Target()]
+			if seen && changed(last, r) || !seen && r.InUse {
+				fmt.Printf("%s ", formatTime(time.Now()))
+				printResult(r, showPID)
+			}
+			latest[r.Target()] = r
+		}
+
+		select {
+		case <-time.After(opts.interval):
+		case <-ctx.Done():
+			// --max-runtime or --deadline.
+			return
+		case sig := <-stop:
+			logf("Received %v, stopping", sig)
+			return
+		case <-hup:
+			if opts.targetsJSON == "" {
+				logf("Received SIGHUP; targets come from the command line, nothing to reload")
+				continue
+			}
+			reloaded, err := load()
+			if err != nil {
+				logf("Reload failed, keeping %d targets: %v", len(targets), err)
+				continue
+			}
+			targets = reloaded
+			kept := make(map[Target]PortResult, len(targets))
+			for _, t := range targets {
+				if r, ok := latest[t]; ok {
+					kept[t] = r
+				}
+			}
+			latest = kept
+			logf("Reloaded %s: %d targets", opts.targetsJSON, len(targets))
+		}
+	}
+}
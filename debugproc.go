@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// debugProc is the hidden --debug-proc mode. It dumps every socket on a
+// port from each /proc/net table as readProcNet decodes it, along with the
+// owner findPIDByInode finds, so a failed --pid lookup can be traced to
+// its cause: no socket at all, a socket in an unexpected state, or an
+// inode of 0 (a TIME_WAIT socket, owned by no process) or one that
+// belongs to a process we can't inspect.
+func debugProc(port int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tLOCAL\tREMOTE\tSTATE\tBOUND\tUID\tINODE\tOWNER")
+	found := 0
+	for _, proto := range []string{"tcp", "udp"} {
+		for _, f := range procNetFiles(proto) {
+			for _, s := range readProcNet(f) {
+				if s.Port != port {
+					continue
+				}
+				found++
+				owner := "-"
+				if s.Inode != "0" {
+					if pid, name, stopped := findPIDByInode(s.Inode); pid > 0 {
+						owner = name + "/" + strconv.Itoa(pid)
+					} else if stopped {
+						owner = "lookup stopped early"
+					} else {
+						owner = "not found"
+					}
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s (%s)\t%t\t%s\t%s\t%s\n",
+					f, netip.AddrPortFrom(s.Addr, uint16(s.Port)), s.Remote, stateName(proto, s.State), s.State,
+					isBound(proto, s.State), s.UID, s.Inode, owner)
+			}
+		}
+	}
+	w.Flush()
+	fmt.Printf("\n%d sockets on port %d\n", found, port)
+}
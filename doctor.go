@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// doctor prints a checklist of what portcheck needs from the system, so a
+// user can see why --pid or another mode comes up empty before trusting
+// its results. It exits 1 if any check failed outright.
+func doctor() {
+	failed := false
+	pass := func(msg string, args ...any) {
+		fmt.Printf("%s%s%s %s\n", green, symbolPass, reset, fmt.Sprintf(msg, args...))
+	}
+	warn := func(msg string, args ...any) { fmt.Printf("%s!%s %s\n", yellow, reset, fmt.Sprintf(msg, args...)) }
+	fail := func(msg string, args ...any) {
+		fmt.Printf("%s%s%s %s\n", red, symbolFail, reset, fmt.Sprintf(msg, args...))
+		failed = true
+	}
+
+	if _, err := os.ReadFile("/proc/net/tcp"); err != nil {
+		fail("/proc/net/tcp is not readable (%v): --pid, status and socket states won't work", err)
+	} else {
+		pass("/proc/net/tcp is readable")
+	}
+
+	if hasIPv6 {
+		pass("IPv6 is available")
+	} else {
+		warn("IPv6 is unavailable; only IPv4 sockets will be checked")
+	}
+
+	if os.Geteuid() == 0 {
+		pass("Running as root: every process's sockets can be traced")
+	} else if _, err := os.ReadDir("/proc/1/fd"); err != nil {
+		warn("Not running as root: --pid can only name your own processes (try sudo)")
+	} else {
+		pass("Other users' processes can be inspected")
+	}
+
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		warn("Could not read the open-file limit: %v", err)
+	} else if rl.Cur != ^uint64(0) && rl.Cur < uint64(opts.concurrency+fdHeadroom) {
+		warn("Open-file limit is %d; range scans will run fewer than %d checks at a time (raise it with ulimit -n)", rl.Cur, opts.concurrency)
+	} else {
+		pass("Open-file limit is %s", formatLimit(rl.Cur))
+	}
+
+	if lo, hi, ok := ephemeralRange(); ok {
+		pass("Ephemeral port range is %d-%d", lo, hi)
+	} else {
+		warn("Ephemeral port range could not be read; the ephemeral target won't work")
+	}
+	if start := unprivilegedPortStart(); start > 1 && os.Geteuid() != 0 {
+		warn("Ports below %d need root to bind, so they will show as in use", start)
+	}
+
+	// portcheck itself reads /proc; these only matter for cross-checking
+	// its answers, or on a system without /proc.
+	for _, tool := range []string{"lsof", "netstat", "ss"} {
+		if path, err := exec.LookPath(tool); err == nil {
+			pass("%s found at %s", tool, path)
+		} else {
+			warn("%s not found (only needed to cross-check results)", tool)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func formatLimit(n uint64) string {
+	if n == ^uint64(0) {
+		return "unlimited"
+	}
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialNetwork returns the network to dial for a protocol, restricted by
+// --family.
+func dialNetwork(proto string) string {
+	return proto + opts.family
+}
+
+// checkFamilies checks a remote port over IPv4 and IPv6 separately when the
+// host name resolves to both, since a single dial only tries whichever
+// address comes first and hides a family that is filtered. Otherwise, or
+// with --family, it is a plain checkTarget. Either way each check goes
+// through checkTarget, so --stability applies to each family.
+func checkFamilies(ctx context.Context, host string, port int) PortResult {
+	check := func(host string) PortResult {
+		return checkTarget(ctx, Target{Host: host, Port: port, Protocol: "tcp"}, false)
+	}
+	if opts.family != "" || net.ParseIP(host) != nil {
+		return check(host)
+	}
+	ips, err := lookupIP(ctx, host)
+	if err != nil {
+		return check(host) // reports the lookup error
+	}
+	v4, v6 := splitFamilies(ips)
+	if v4 == nil || v6 == nil {
+		return check(host)
+	}
+
+	r4, r6 := check(v4[0].String()), check(v6[0].String())
+	result := PortResult{
+		Port:       port,
+		Protocol:   "tcp",
+		Host:       host,
+		InUse:      r4.InUse || r6.InUse,
+		Unstable:   r4.Unstable || r6.Unstable,
+		DurationMS: max(r4.DurationMS, r6.DurationMS),
+		Reachability: map[string]string{
+			"ipv4": reachability(r4),
+			"ipv6": reachability(r6),
+		},
+	}
+	result.DetectedProto = r4.DetectedProto
+	if result.DetectedProto == "" {
+		result.DetectedProto = r6.DetectedProto
+	}
+	return result
+}
+
+// splitFamilies splits a host's addresses into IPv4 and IPv6, each in the
+// order the resolver returned them.
+func splitFamilies(ips []net.IP) (v4, v6 []net.IP) {
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	return v4, v6
+}
+
+// familyAddrs caches the addresses each host name resolved to, so a range
+// scan looks a name up once rather than once per port.
+var familyAddrs sync.Map
+
+// lookupIP resolves a host name through the familyAddrs cache.
+func lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ips, ok := familyAddrs.Load(host); ok {
+		return ips.([]net.IP), nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	found, _ := familyAddrs.LoadOrStore(host, ips)
+	return found.([]net.IP), nil
+}
+
+// fallbackFamilies returns the family ("4" or "6") of the first address a
+// host name resolved to and the other family, or "" when the host is an
+// address, doesn't resolve to both families, or --family or --proxy
+// decides how to connect.
+func fallbackFamilies(ctx context.Context, host string) (first, other string) {
+	if opts.family != "" || opts.proxy != nil || net.ParseIP(host) != nil {
+		return "", ""
+	}
+	ips, err := lookupIP(ctx, host)
+	if err != nil {
+		return "", "" // the dial reports the lookup error
+	}
+	v4, v6 := splitFamilies(ips)
+	switch {
+	case v4 == nil || v6 == nil:
+		return "", ""
+	case ips[0].To4() != nil:
+		return "4", "6"
+	}
+	return "6", "4"
+}
+
+// dialFallback connects to a remote port. When the host name resolves to
+// both IPv4 and IPv6, it dials the family the resolver put first and, if
+// that fails, the other family before giving up, as Happy Eyeballs would,
+// but records in the result which family connected (Family) and which
+// failed first (FallbackFrom). Each family's dial tries all of its
+// addresses. The error is the first family's, and DurationMS is how long
+// the answering dial took, so a fallback isn't timed with the failed try.
+func dialFallback(ctx context.Context, r *PortResult) error {
+	first, other := fallbackFamilies(ctx, r.Host)
+	if first == "" {
+		return timedDial(r, func() error { return dialPort(ctx, r.Host, r.Port) })
+	}
+	err := timedDial(r, func() error { return dialFamily(ctx, first, r.Host, r.Port) })
+	if err == nil {
+		r.Family = "ipv" + first
+		return nil
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	var fallback PortResult
+	if timedDial(&fallback, func() error { return dialFamily(ctx, other, r.Host, r.Port) }) == nil {
+		r.Family, r.FallbackFrom = "ipv"+other, "ipv"+first
+		r.DurationMS = fallback.DurationMS
+		return nil
+	}
+	return err
+}
+
+// timedDial runs dial and records how long it took in r.DurationMS.
+func timedDial(r *PortResult, dial func() error) error {
+	start := time.Now()
+	err := dial()
+	r.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	return err
+}
+
+// dialFamily connects to a remote port over one address family ("4" or
+// "6"), trying each of the host's addresses in that family in turn.
+func dialFamily(ctx context.Context, family, host string, port int) error {
+	dialer := newDialer("tcp")
+	conn, err := dialer.DialContext(ctx, "tcp"+family, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err == nil {
+		closeFromSourcePort(conn)
+	}
+	return err
+}
+
+// formatFallback renders a result that connected over its second family as
+// " (over IPv4, IPv6 failed)", or "" otherwise.
+func formatFallback(r PortResult) string {
+	if r.FallbackFrom == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (over %s, %s failed)", familyName(r.Family), familyName(r.FallbackFrom))
+}
+
+func familyName(family string) string {
+	return strings.Replace(family, "ip", "IP", 1)
+}
+
+// reachability describes a remote result as open, closed (refused),
+// filtered (timed out) or unreachable (any other error, such as no route).
+func reachability(r PortResult) string {
+	switch {
+	case r.InUse:
+		return "open"
+	case r.Err == "":
+		return "closed"
+	case strings.Contains(r.Err, "timeout"):
+		return "filtered"
+	}
+	return "unreachable"
+}
+
+// formatReachability renders the per-family states as " (IPv4 open, IPv6
+// filtered)", or "" for a single-family result.
+func formatReachability(r PortResult) string {
+	if len(r.Reachability) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (IPv4 %s, IPv6 %s)", r.Reachability["ipv4"], r.Reachability["ipv6"])
+}
+
+// exitUnresolved is the exit status when the --host name doesn't resolve,
+// set apart from 1 so scripts can tell a DNS problem from closed ports.
+const exitUnresolved = 3
+
+// requireResolvable exits with exitUnresolved if host is a name that
+// doesn't resolve, rather than letting every port of a scan fail and read
+// as closed. Only a definite answer from DNS counts; a lookup that timed
+// out is left for the checks to report.
+func requireResolvable(ctx context.Context, host string) {
+	if err := resolveError(ctx, host); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", red, err, reset)
+		os.Exit(exitUnresolved)
+	}
+}
+
+// resolveError returns a "could not resolve host" error if host is a name
+// that DNS says doesn't exist, and nil otherwise.
+func resolveError(ctx context.Context, host string) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	_, err := net.DefaultResolver.LookupHost(ctx, host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && !dnsErr.Timeout() {
+		return fmt.Errorf("could not resolve host %s: %s", host, dnsErr.Err)
+	}
+	return nil
+}
+
+// unresolvedError rewords a failed dial's DNS error as the clearer "could
+// not resolve host", and passes other errors through.
+func unresolvedError(host string, err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && !dnsErr.Timeout() {
+		return fmt.Sprintf("could not resolve host %s: %s", host, dnsErr.Err)
+	}
+	return err.Error()
+}
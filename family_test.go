@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// unresolvable is a name that can never resolve (RFC 2606).
+const unresolvable = "portcheck-test.invalid"
+
+func TestResolveError(t *testing.T) {
+	err := resolveError(context.Background(), unresolvable)
+	if err == nil || !strings.HasPrefix(err.Error(), "could not resolve host "+unresolvable) {
+		t.Errorf("resolveError(%q) = %v, want could not resolve host", unresolvable, err)
+	}
+	if err := resolveError(context.Background(), "127.0.0.1"); err != nil {
+		t.Errorf("resolveError(127.0.0.1) = %v, want nil", err)
+	}
+}
+
+func TestCheckRemoteUnresolvable(t *testing.T) {
+	r := checkRemote(context.Background(), unresolvable, 80)
+	if r.InUse || !strings.HasPrefix(r.Err, "could not resolve host "+unresolvable) {
+		t.Errorf("checkRemote(%q) = in use %v, error %q, want could not resolve host", unresolvable, r.InUse, r.Err)
+	}
+}
+
+// TestRequireResolvableExitCode runs requireResolvable in a child process,
+// since it exits, and checks the exit status.
+func TestRequireResolvableExitCode(t *testing.T) {
+	if os.Getenv("PORTCHECK_TEST_UNRESOLVABLE") == "1" {
+		requireResolvable(context.Background(), unresolvable)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRequireResolvableExitCode$")
+	cmd.Env = append(os.Environ(), "PORTCHECK_TEST_UNRESOLVABLE=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitUnresolved {
+		t.Fatalf("exit status = %v, want %d", err, exitUnresolved)
+	}
+	if !strings.Contains(string(out), "could not resolve host "+unresolvable) {
+		t.Errorf("output = %q, want could not resolve host", out)
+	}
+}
+
+func TestSplitFamilies(t *testing.T) {
+	ips := []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::2"), net.ParseIP("192.0.2.2")}
+	v4, v6 := splitFamilies(ips)
+	if len(v4) != 2 || !v4[0].Equal(ips[1]) || !v4[1].Equal(ips[3]) {
+		t.Errorf("IPv4 = %v, want %v and %v in order", v4, ips[1], ips[3])
+	}
+	if len(v6) != 2 || !v6[0].Equal(ips[0]) || !v6[1].Equal(ips[2]) {
+		t.Errorf("IPv6 = %v, want %v and %v in order", v6, ips[0], ips[2])
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// findFree prints the first k available ports among ports, in order, one
+// per line, stopping as soon as it has k. Nothing holds the ports after it
+// exits, so a caller should bind them promptly. It exits 1, saying how many
+// it found, if there are fewer than k.
+func findFree(ctx context.Context, ports []int, k int) {
+	var found []int
+	for _, port := range ports {
+		if len(found) == k || ctx.Err() != nil {
+			break
+		}
+		if !checkPort(ctx, port, false).InUse {
+			found = append(found, port)
+		}
+	}
+	if len(found) < k {
+		fmt.Fprintf(os.Stderr, "%sError: only %d of the %d free ports asked for are available in %s%s\n",
+			red, len(found), k, formatPortList(ports), reset)
+		os.Exit(1)
+	}
+	for _, port := range found {
+		fmt.Println(port)
+	}
+}
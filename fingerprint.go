@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// fingerprint returns a stable hash of the in-use ports among results, for
+// --fingerprint. Two scans of the same ports fingerprint the same exactly
+// when they found the same set in use, whatever order the checks finished
+// in. With --pid the owning process name is part of each entry, so a
+// service replaced by another on the same port changes the hash; PIDs are
+// left out as they change on every restart.
+func fingerprint(results []PortResult) string {
+	var entries []string
+	for _, r := range results {
+		if !r.InUse {
+			continue
+		}
+		entry := r.Target().String()
+		if r.Process != "" {
+			entry += " " + r.Process
+		}
+		entries = append(entries, entry)
+	}
+	slices.Sort(entries)
+	sum := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// printFingerprint prints the --fingerprint line of a text summary.
+func printFingerprint(results []PortResult) {
+	if opts.fingerprint {
+		fmt.Printf("%sFingerprint: %s%s\n", cyan, fingerprint(results), reset)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// freeTimeout is how long free waits for the port to be released after
+// asking its owner to stop.
+const freeTimeout = 5 * time.Second
+
+// freePort stops the process holding a port with SIGTERM and waits until
+// the port can be bound again. It asks for confirmation first unless --yes
+// is given, and leaves privileged ports, which usually belong to system
+// services, alone unless --force is given.
+func freePort(ctx context.Context, port int) {
+	r := checkPort(ctx, port, true)
+	if !r.InUse {
+		printResult(r, false)
+		return
+	}
+	if r.PID == 0 {
+		fmt.Fprintf(os.Stderr, "%sError: port %d is in use but its process could not be found (try sudo)%s\n", red, port, reset)
+		os.Exit(1)
+	}
+	if port < unprivilegedPortStart() && !opts.force {
+		fmt.Fprintf(os.Stderr, "%sError: port %d is a privileged port, likely a system service (%s, PID %d); use --force to stop it anyway%s\n",
+			red, port, r.Process, r.PID, reset)
+		os.Exit(1)
+	}
+
+	if !opts.yes && !confirm(fmt.Sprintf("Stop %s (PID %d) holding port %d? [y/N] ", r.Process, r.PID, port)) {
+		fmt.Println("Aborted")
+		os.Exit(1)
+	}
+	if err := syscall.Kill(r.PID, syscall.SIGTERM); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: could not stop PID %d: %v%s\n", red, r.PID, err, reset)
+		os.Exit(1)
+	}
+
+	deadline := time.Now().Add(freeTimeout)
+	for checkPort(ctx, port, false).InUse {
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "%sError: sent SIGTERM to PID %d, but port %d is still in use after %v%s\n", red, r.PID, port, freeTimeout, reset)
+			os.Exit(1)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Printf("%s%s%s Stopped %s (PID %d); port %s%d%s is now %s%savailable%s\n",
+		green, symbolPass, reset, r.Process, r.PID, bold, port, reset, green, bold, reset)
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no.
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -1,3 +1,11 @@
 module github.com/kai-wave/portcheck
 
 go 1.24.4
+
+require (
+	golang.org/x/net v0.46.0
+	golang.org/x/term v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.37.0 // indirect
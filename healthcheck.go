@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// healthcheck dials a port once and exits 0 if something accepted the
+// connection, 1 otherwise. It prints nothing unless --verbose is set, so it
+// can be dropped straight into a liveness or readiness probe.
+func healthcheck(ctx context.Context, port int) {
+	host := opts.host
+	if host == "" {
+		host = "localhost"
+	}
+	if err := dialPort(ctx, host, port); err != nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "%sunhealthy: %v%s\n", red, err, reset)
+		}
+		os.Exit(1)
+	}
+	if opts.verbose {
+		fmt.Printf("%shealthy: %s port %d accepted a connection%s\n", green, host, port, reset)
+	}
+	os.Exit(0)
+}
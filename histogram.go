@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the --verbose latency histogram
+// of a remote scan; checks that timed out get a bucket of their own.
+var latencyBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"<10ms", 10 * time.Millisecond},
+	{"<100ms", 100 * time.Millisecond},
+	{"<1s", time.Second},
+	{">=1s", 0},
+}
+
+// latencyHistogram counts the check durations of a remote scan.
+type latencyHistogram struct {
+	counts   [4]int
+	timedOut int
+}
+
+// add counts one result. A check that ended in a timeout, including a UDP
+// port that never replied, is counted as timed out whatever its duration.
+func (h *latencyHistogram) add(r PortResult) {
+	d := time.Duration(r.DurationMS * float64(time.Millisecond))
+	if r.State == stateOpenFiltered || r.Err != "" && d >= opts.portTimeout {
+		h.timedOut++
+		return
+	}
+	for i, b := range latencyBuckets {
+		if b.limit == 0 || d < b.limit {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// print draws the histogram as bars scaled to the largest bucket.
+func (h *latencyHistogram) print() {
+	largest := h.timedOut
+	for _, n := range h.counts {
+		largest = max(largest, n)
+	}
+	if largest == 0 {
+		return
+	}
+	bar := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return " " + strings.Repeat(histogramBar, (n*30+largest-1)/largest)
+	}
+	fmt.Printf("%sCheck latency:%s\n", cyan, reset)
+	for i, b := range latencyBuckets {
+		fmt.Printf("  %-9s %6s%s\n", b.label, formatCount(h.counts[i]), bar(h.counts[i]))
+	}
+	fmt.Printf("  %-9s %6s%s%s%s\n", "timed out", formatCount(h.timedOut), yellow, bar(h.timedOut), reset)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// formatCount formats a count for the text summaries: with --human, large
+// numbers get thousands separators, as in "12,345".
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	if !opts.human || len(s) <= 3 {
+		return s
+	}
+	start := len(s) % 3
+	if start == 0 {
+		start = 3
+	}
+	out := s[:start]
+	for i := start; i < len(s); i += 3 {
+		out += "," + s[i:i+3]
+	}
+	return out
+}
+
+// formatElapsed formats how long something took for the text summaries.
+// By default it is Go's duration to the millisecond ("1.234s"); --human
+// keeps only what a reader needs: "340ms", "1.2s" or "2m5s".
+func formatElapsed(d time.Duration) string {
+	if !opts.human {
+		return d.Round(time.Millisecond).String()
+	}
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
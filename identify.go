@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// identifyTimeout bounds each step of a --identify probe, so a silent
+// service costs at most three of these on top of the connect.
+const identifyTimeout = 500 * time.Millisecond
+
+// identifyProtocol guesses what an open port speaks. Servers that talk
+// first (SSH, FTP, SMTP) are recognised by their banner; a silent one is
+// offered a TLS handshake and then, on a fresh connection, an HTTP HEAD
+// request. It returns "" when none of these fit.
+func identifyProtocol(ctx context.Context, host string, port int) string {
+	dial := func() (net.Conn, error) { return dialTCP(ctx, host, port) }
+
+	conn, err := dial()
+	if err != nil {
+		return ""
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(identifyTimeout))
+	n, err := conn.Read(buf)
+	conn.Close()
+	if n > 0 {
+		return classifyBanner(buf[:n])
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		return "" // closed on us without a word
+	}
+
+	if conn, err = dial(); err != nil {
+		return ""
+	}
+	hctx, cancel := context.WithTimeout(ctx, identifyTimeout)
+	// Only whether the server completes a handshake matters, not who it is.
+	err = tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: host}).HandshakeContext(hctx)
+	cancel()
+	conn.Close()
+	if err == nil {
+		return "tls"
+	}
+
+	if conn, err = dial(); err != nil {
+		return ""
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(identifyTimeout))
+	if _, err := conn.Write([]byte("HEAD / HTTP/1.0\r\n\r\n")); err != nil {
+		return ""
+	}
+	n, _ = conn.Read(buf)
+	if bytes.HasPrefix(buf[:n], []byte("HTTP/")) {
+		return "http"
+	}
+	return ""
+}
+
+// classifyBanner names a protocol from what a server sent unprompted.
+func classifyBanner(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		return "ssh"
+	case bytes.HasPrefix(b, []byte("220")) && bytes.Contains(bytes.ToUpper(b), []byte("FTP")):
+		return "ftp"
+	case bytes.HasPrefix(b, []byte("220")):
+		return "smtp"
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// portInfo is what the info command knows about a port without touching
+// the network.
+type portInfo struct {
+	Port        int    `json:"port"`
+	TCPService  string `json:"tcp_service,omitempty"`
+	UDPService  string `json:"udp_service,omitempty"`
+	Category    string `json:"category"`
+	Description string `json:"description,omitempty"`
+	Ephemeral   bool   `json:"ephemeral"`
+}
+
+// portCategory returns the IANA range a port falls in: well-known ports
+// are assigned by IANA to system services, registered ones are listed on
+// request, and dynamic ones are never assigned.
+func portCategory(port int) string {
+	switch {
+	case port < 1024:
+		return "well-known"
+	case port < 49152:
+		return "registered"
+	}
+	return "dynamic"
+}
+
+// categoryRanges gives the port range of each category for display.
+var categoryRanges = map[string]string{
+	"well-known": "0-1023",
+	"registered": "1024-49151",
+	"dynamic":    "49152-65535",
+}
+
+// info prints the service name, IANA category and description of a port,
+// from the same table that labels scan results. Nothing is probed.
+func info(port int) {
+	if err := loadServices(); err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+	pi := portInfo{
+		Port:        port,
+		TCPService:  serviceName("tcp", port),
+		UDPService:  serviceName("udp", port),
+		Category:    portCategory(port),
+		Description: builtinServices[port].description,
+	}
+	lo, hi, ok := ephemeralRange()
+	pi.Ephemeral = ok && port >= lo && port <= hi
+
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(pi); err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+			os.Exit(2)
+		}
+		return
+	}
+
+	service := pi.TCPService
+	switch {
+	case pi.TCPService == "" && pi.UDPService == "":
+		service = "unknown"
+	case pi.TCPService == pi.UDPService:
+	case pi.TCPService == "":
+		service = pi.UDPService + " (udp)"
+	case pi.UDPService == "":
+		service += " (tcp)"
+	default:
+		service = fmt.Sprintf("%s (tcp), %s (udp)", pi.TCPService, pi.UDPService)
+	}
+	fmt.Printf("Port %s%d%s\n", bold, port, reset)
+	fmt.Printf("  Service:     %s%s%s\n", cyan, service, reset)
+	fmt.Printf("  Category:    %s (%s)\n", pi.Category, categoryRanges[pi.Category])
+	if pi.Description != "" {
+		fmt.Printf("  Description: %s\n", pi.Description)
+	}
+	if pi.Ephemeral {
+		fmt.Printf("  %sIn this system's ephemeral range (%d-%d): the kernel may hand it out for outgoing connections%s\n", yellow, lo, hi, reset)
+	}
+}
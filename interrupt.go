@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+)
+
+// interrupted is set once Ctrl-C has stopped a range scan.
+var interrupted atomic.Bool
+
+// interruptible returns a context that is canceled by the first SIGINT,
+// so a range scan stops and reports what it has instead of dying with
+// nothing. The handler is removed as soon as it fires, leaving a second
+// Ctrl-C to kill the process as usual should the wind-down hang.
+func interruptible(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			signal.Stop(sigs)
+			interrupted.Store(true)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// exitIfInterrupted exits with status 130, as a shell does for a process
+// killed by SIGINT, if Ctrl-C stopped the scan, after the partial results
+// have been printed.
+func exitIfInterrupted() {
+	if interrupted.Load() {
+		fmt.Fprintf(os.Stderr, "%sInterrupted; results are partial%s\n", yellow, reset)
+		os.Exit(130)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// listeningPorts returns the sorted, de-duplicated ports the kernel reports
+// as bound for a protocol: TCP listeners, or any UDP socket. With
+// --ignore-loopback, ports whose sockets are all bound to loopback are left
+// out.
+func listeningPorts(proto string) []int {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, f := range procNetFiles(proto) {
+		for _, s := range readProcNet(f) {
+			if !isBound(proto, s.State) || seen[s.Port] {
+				continue
+			}
+			if opts.ignoreLoopback && s.isLoopback() {
+				continue
+			}
+			seen[s.Port] = true
+			ports = append(ports, s.Port)
+		}
+	}
+
+	for i := range ports {
+		for j := i + 1; j < len(ports); j++ {
+			if ports[i] > ports[j] {
+				ports[i], ports[j] = ports[j], ports[i]
+			}
+		}
+	}
+	return ports
+}
+
+// checkListening cross-checks the kernel's view of listening sockets against
+// actual bindability, reporting any port that is listed as LISTEN in /proc
+// but could still be bound.
+func checkListening(showPID bool) {
+	ports := listeningPorts("tcp")
+	if len(ports) == 0 {
+		fmt.Println(yellow + "No listening ports found in /proc/net/tcp" + reset)
+		return
+	}
+
+	fmt.Printf("%sVerifying %d listening ports...%s\n\n", cyan, len(ports), reset)
+	startTime := time.Now()
+
+	var discrepancies []int
+	results := scanPorts(context.Background(), ports, showPID)
+	for _, r := range results {
+		if r.InUse {
+			printResult(r, showPID)
+		} else {
+			discrepancies = append(discrepancies, r.Port)
+		}
+	}
+
+	if len(discrepancies) > 0 {
+		fmt.Printf("\n%s%sDiscrepancies:%s\n", bold, yellow, reset)
+		for _, port := range discrepancies {
+			fmt.Printf("%s!%s Port %s%d%s is listed as LISTEN by the kernel but could be bound\n", yellow, reset, bold, port, reset)
+		}
+	}
+
+	fmt.Printf("\n%s%s listening ports verified in %s | %s confirmed, %s discrepancies%s\n",
+		cyan, formatCount(len(ports)), formatElapsed(time.Since(startTime)), formatCount(len(ports)-len(discrepancies)), formatCount(len(discrepancies)), reset)
+	printProcessCount(results)
+}
+
+// showStatus prints a table of every listening TCP port and bound UDP port
+// on the machine together with the process that owns it.
+func showStatus() {
+	if opts.unix {
+		showUnixSockets()
+		return
+	}
+	var results []PortResult
+	for _, proto := range []string{"tcp", "udp"} {
+		for _, port := range listeningPorts(proto) {
+			results = append(results, PortResult{Port: port, InUse: true, Protocol: proto})
+		}
+	}
+	resolveProcesses(results)
+	if opts.tcpKeepalive {
+		countKeepalive(results)
+	}
+
+	if opts.since > 0 {
+		results = startedWithin(results, opts.since)
+	}
+	if opts.onlyProcess != "" {
+		results = ownedBy(results, opts.onlyProcess)
+	}
+
+	if machineReadable() {
+		exitReport(results, 0)
+	}
+	if len(results) == 0 {
+		if opts.since > 0 {
+			fmt.Printf("%sNo listening ports owned by processes started in the last %v%s\n", yellow, opts.since, reset)
+		} else if opts.onlyProcess != "" {
+			fmt.Printf("%sNo listening ports owned by %s%s\n", yellow, opts.onlyProcess, reset)
+		} else {
+			fmt.Println(yellow + "No listening ports found" + reset)
+		}
+		enforcePolicy(results)
+		return
+	}
+
+	// The table is laid out in a buffer so that rows can be cut to --wrap.
+	// Only a process column in last place is shortened; when --columns puts
+	// anything else there, rows are left whole rather than cut mid-field.
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	width := lineWidth()
+	if cols := opts.columns; cols != nil {
+		if last := cols[len(cols)-1].Name; last != "process" && last != "cmdline" {
+			width = 0
+		}
+		writeColumns(w, results)
+	} else {
+		writeStatusRows(w, results)
+	}
+	w.Flush()
+	for line := range strings.Lines(table.String()) {
+		line = strings.TrimSuffix(line, "\n")
+		if width > 0 {
+			line = truncate(line, width)
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Printf("\n%s%s listening ports%s\n", cyan, formatCount(len(results)), reset)
+	printProcessCount(results)
+	enforcePolicy(results)
+}
+
+// countKeepalive fills in, for each TCP listener, how many connections it
+// has established and how many of those have the keepalive timer pending,
+// which is how an idle connection with SO_KEEPALIVE shows in /proc. A
+// connection with data in flight shows the retransmit timer instead, so
+// the keepalive count is a lower bound.
+func countKeepalive(results []PortResult) {
+	type counts struct{ established, keepalive int }
+	byPort := make(map[int]counts)
+	for _, f := range procNetFiles("tcp") {
+		for _, s := range readProcNet(f) {
+			if s.State != tcpEstablished {
+				continue
+			}
+			c := byPort[s.Port]
+			c.established++
+			if s.TimerState == "keepalive" {
+				c.keepalive++
+			}
+			byPort[s.Port] = c
+		}
+	}
+	for i := range results {
+		if r := &results[i]; r.Protocol == "tcp" {
+			c := byPort[r.Port]
+			r.Connections, r.KeepaliveConns = c.established, c.keepalive
+		}
+	}
+}
+
+// startedWithin keeps the results whose owning process started less than d
+// ago. Ports whose process couldn't be resolved are dropped, since their
+// age is unknown.
+func startedWithin(results []PortResult, d time.Duration) []PortResult {
+	cutoff := time.Now().Add(-d)
+	var recent []PortResult
+	for _, r := range results {
+		if started, ok := processStartTime(r.PID); r.PID > 0 && ok && started.After(cutoff) {
+			recent = append(recent, r)
+		}
+	}
+	return recent
+}
+
+// ownedBy keeps the in-use results whose process name contains name, or
+// equals it with --exact. Free ports and unresolved owners are dropped.
+func ownedBy(results []PortResult, name string) []PortResult {
+	var owned []PortResult
+	for _, r := range results {
+		if !r.InUse || r.PID == 0 {
+			continue
+		}
+		if r.Process == name || !opts.exact && strings.Contains(r.Process, name) {
+			owned = append(owned, r)
+		}
+	}
+	return owned
+}
+
+// writeStatusRows writes the default status table. --verbose adds the
+// accept queue, which shows a listener falling behind on accepting
+// connections, and --tcp-keepalive the keepalive state of its connections.
+func writeStatusRows(w io.Writer, results []PortResult) {
+	header := "PROTO\tPORT\t"
+	if opts.verbose {
+		header += "ACCEPT-Q\t"
+	}
+	if opts.tcpKeepalive {
+		header += "KEEPALIVE\t"
+	}
+	fmt.Fprintln(w, header+"PID\tPROCESS")
+	for _, r := range results {
+		port := strconv.Itoa(r.Port)
+		if name := serviceName(r.Protocol, r.Port); opts.resolve && name != "" {
+			port += " (" + name + ")"
+		}
+		pid, process := "-", "-"
+		if r.PID > 0 {
+			pid, process = strconv.Itoa(r.PID), r.Process
+			if r.Cmdline != "" {
+				process = r.Cmdline
+			}
+			if r.OwnedByMe {
+				process += " (yours)"
+			}
+		}
+		row := r.Protocol + "\t" + port + "\t"
+		if opts.verbose {
+			// Waiting connections out of the backlog, as ss shows them.
+			queue := "-"
+			if r.Protocol == "tcp" && r.QueueMax > 0 {
+				queue = fmt.Sprintf("%d/%d", r.QueueLen, r.QueueMax)
+			} else if r.Protocol == "tcp" {
+				queue = strconv.Itoa(r.QueueLen)
+			}
+			row += queue + "\t"
+		}
+		if opts.tcpKeepalive {
+			// Connections with keepalive out of those established.
+			keepalive := "-"
+			if r.Connections > 0 {
+				keepalive = fmt.Sprintf("%d/%d", r.KeepaliveConns, r.Connections)
+			}
+			row += keepalive + "\t"
+		}
+		fmt.Fprintln(w, row+pid+"\t"+process)
+	}
+}
+
+// writeColumns writes the status table with the --columns fields, leaving
+// a "-" in empty cells so the columns stay aligned.
+func writeColumns(w io.Writer, results []PortResult) {
+	labelServices(results)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columnNames(opts.columns), "\t")))
+	for _, r := range results {
+		values := columnValues(opts.columns, r)
+		for i, v := range values {
+			if v == "" {
+				values[i] = "-"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+}
@@ -2,28 +2,191 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
 	"os"
-	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-const (
+var (
 	reset, red, green, yellow, cyan, bold = "\033[0m", "\033[31m", "\033[32m", "\033[33m", "\033[36m", "\033[1m"
 )
 
 type PortResult struct {
-	Port    int
-	InUse   bool
-	PID     int
-	Process string
+	Port     int    `json:"port"`
+	InUse    bool   `json:"in_use"`
+	PID      int    `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+	Cmdline  string `json:"cmdline,omitempty"`
+	Protocol string `json:"protocol"`
+	Wildcard string `json:"wildcard,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Err      string `json:"error,omitempty"`
+	State    string `json:"state,omitempty"`
+	Family   string `json:"family,omitempty"`
+	Service  string `json:"service,omitempty"`
+	// OwnedByMe is set when the owning process runs as the current user.
+	OwnedByMe bool `json:"owned_by_me,omitempty"`
+	// QueueLen is how many connections wait in a TCP listener's accept
+	// queue, as reported by /proc/net/tcp, and QueueMax how many it can
+	// hold (the listen backlog), from NETLINK_SOCK_DIAG.
+	QueueLen int `json:"queue_len,omitempty"`
+	QueueMax int `json:"queue_max,omitempty"`
+	// Reachability is the state of a remote port over each address family
+	// ("ipv4", "ipv6") when its host resolves to both.
+	Reachability map[string]string `json:"reachability,omitempty"`
+	// FallbackFrom is the address family ("ipv4", "ipv6") that failed
+	// before a dual-stack host accepted the connection over the other one,
+	// which is then in Family.
+	FallbackFrom string `json:"fallback_from,omitempty"`
+	// Unstable is set when --stability checks disagreed; InUse is then the
+	// first check's answer.
+	Unstable bool `json:"unstable,omitempty"`
+	// DetectedProto is the protocol --identify guessed an open port speaks.
+	DetectedProto string `json:"detected_proto,omitempty"`
+	// DurationMS is how long the connection attempt took in remote mode.
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	// Tier is "ok" or "slow" for a port that accepted the connection,
+	// depending on whether it did so within --sla.
+	Tier string `json:"tier,omitempty"`
+	// Probe is the payload sent to a remote UDP port: "empty", or the
+	// --udp-probe service name such as "dns".
+	Probe string `json:"probe,omitempty"`
+	// Connections is how many established connections a TCP listener has,
+	// and KeepaliveConns how many of them have a keepalive timer pending.
+	// Both are only filled in by status --tcp-keepalive.
+	Connections    int `json:"connections,omitempty"`
+	KeepaliveConns int `json:"keepalive_connections,omitempty"`
+	// TimerState is the kernel timer pending on a TCP port's own socket,
+	// decoded from the timer column of /proc/net/tcp: "off",
+	// "retransmit", "keepalive", "time_wait" or "zero_window_probe".
+	TimerState string `json:"timer_state,omitempty"`
+	// PIDLookupStopped is set when the process lookup gave up after
+	// --pid-timeout, or --pid-max-scan processes, before finding the owner.
+	PIDLookupStopped bool `json:"pid_lookup_stopped,omitempty"`
 }
 
+// options holds the command-line flags that aren't threaded through as
+// function arguments.
+type options struct {
+	verbose        bool
+	fullCommand    bool
+	tree           bool
+	resolve        bool
+	wrap           int
+	fromListening  bool
+	status         bool
+	jitter         time.Duration
+	json           bool
+	udp            bool
+	header         bool
+	passes         int
+	passInterval   time.Duration
+	bind           string
+	host           string
+	portTimeout    time.Duration
+	deadline       time.Duration
+	maxRuntime     time.Duration
+	limitOpen      int64
+	targetsJSON    string
+	cidr           string
+	grepable       bool
+	yaml           bool
+	csv            bool
+	noHeader       bool
+	columns        []column
+	output         string
+	outputFD       int
+	appendOutput   bool
+	listenRetries  int
+	retries        int
+	retryBudget    int64
+	failFast       bool
+	identify       bool
+	udpProbe       bool
+	connect        bool
+	countProcs     bool
+	sla            time.Duration
+	failOnSlow     bool
+	mergeProtocols bool
+	ascii          bool
+	assert         string
+	symbolOpen     string
+	symbolClosed   string
+	noSort         bool
+	blocks         bool
+	fingerprint    bool
+	stability      int
+	from           string
+	concurrency    int
+	ramp           time.Duration
+	throttleErrors bool
+	compare        string
+	compareFormat  string
+	family         string
+	proxy          *socksProxy
+	waitOpen       bool
+	daemon         bool
+	findFreeN      int
+	waitCount      int
+	sourcePort     int
+	debugProc      int
+	then           string
+	alertOn        string
+	yes            bool
+	force          bool
+	since          time.Duration
+	interval       time.Duration
+	timeFormat     string
+	ignoreLoopback bool
+	tcpKeepalive   bool
+	onlyProcess    string
+	exact          bool
+	countByState   bool
+	sample         int
+	seed           *uint64
+	noWarnings     bool
+	dedupe         bool
+	servicesFile   string
+	allow          []int
+	deny           []int
+	minPort        int
+	maxPort        int
+	strict         bool
+	all            bool
+	checkBindable  bool
+	backlog        int
+	hold           time.Duration
+	printFD        bool
+	pidTimeout     time.Duration
+	pidMaxScan     int
+	human          bool
+	unix           bool
+	randomize      bool
+	unixSocket     string
+}
+
+var opts = options{portTimeout: 2 * time.Second, interval: time.Second, hold: time.Second, timeFormat: "15:04:05.000", concurrency: 100, pidTimeout: 500 * time.Millisecond, minPort: 1, maxPort: 65535, wrap: -1}
+
+// openSeen counts the in-use ports found so far, for --limit-open.
+var openSeen atomic.Int64
+
+// retriesUsed counts the dial retries spent so far, for --retry-budget.
+var retriesUsed atomic.Int64
+
+// hasIPv6 reports whether the host has a usable IPv6 stack. It is computed
+// once at startup so IPv6-disabled systems skip tcp6 work entirely.
+var hasIPv6 = detectIPv6()
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -31,196 +194,1849 @@ func main() {
 	}
 
 	showPID := false
-	portArg := os.Args[1]
+	portArg := ""
+
+	colorMode, help := "auto", false
+
+	// A leading verb selects a subcommand; anything else is the original
+	// flat interface, kept for backward compatibility.
+	command, first := "", 1
+	if isCommand(os.Args[1]) {
+		command, first = os.Args[1], 2
+	}
+	var flagsUsed []string
+
+	for i := first; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		value := func() string { return flagValue(&i, arg) }
+		if name, inline, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(arg, "--") {
+			arg, value = name, func() string { return inline }
+		}
+		if strings.HasPrefix(arg, "-") {
+			flagsUsed = append(flagsUsed, arg)
+		}
+
+		switch arg {
+		case "-h", "--help":
+			help = true
+		case "-p", "--pid":
+			showPID = true
+		case "-v", "--verbose":
+			opts.verbose = true
+		case "--full-command":
+			opts.fullCommand = true
+		case "--tree":
+			opts.tree = true
+		case "--resolve":
+			opts.resolve = true
+		case "--wrap":
+			cols, err := strconv.Atoi(value())
+			if err != nil || cols < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: --wrap takes a number of columns"+reset)
+				os.Exit(1)
+			}
+			opts.wrap = cols
+		case "--ports-from-listening":
+			opts.fromListening = true
+		case "--status":
+			opts.status = true
+		case "-u", "--udp":
+			opts.udp = true
+		case "-j", "--json":
+			opts.json = true
+		case "-g", "--grepable":
+			opts.grepable = true
+		case "--yaml":
+			opts.yaml = true
+		case "--csv":
+			opts.csv = true
+		case "--no-header":
+			opts.noHeader = true
+		case "-o", "--output":
+			opts.output = value()
+		case "--columns":
+			cols, err := parseColumns(value())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, red+"Error: --columns: "+err.Error()+reset)
+				os.Exit(1)
+			}
+			opts.columns = cols
+		case "--output-fd":
+			fd, err := strconv.Atoi(value())
+			if err != nil || fd < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --output-fd takes a file descriptor number"+reset)
+				os.Exit(1)
+			}
+			opts.outputFD = fd
+		case "--append":
+			opts.appendOutput = true
+		case "--count-by-state":
+			opts.countByState = true
+		case "--sample":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --sample must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.sample = n
+		case "--seed":
+			n, err := strconv.ParseUint(value(), 10, 64)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, red+"Error: --seed must be a non-negative number"+reset)
+				os.Exit(1)
+			}
+			opts.seed = &n
+		case "-a", "--all":
+			opts.all = true
+		case "--check-bindable":
+			opts.checkBindable = true
+		case "--backlog":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --backlog must be at least 1"+reset)
+				os.Exit(1)
+			}
+			// Only a held listener has a backlog to look at.
+			opts.backlog, opts.checkBindable = n, true
+		case "--hold":
+			d, err := time.ParseDuration(value())
+			if err != nil || d < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --hold duration"+reset)
+				os.Exit(1)
+			}
+			opts.hold = d
+		case "--fd":
+			opts.printFD = true
+		case "--services-file":
+			opts.servicesFile = value()
+		case "--dedupe":
+			opts.dedupe = true
+		case "--allow", "--deny":
+			ports, err := parsePortList(value())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, red+"Error: "+arg+": "+parseErrorMessage(err)+reset)
+				os.Exit(1)
+			}
+			if arg == "--allow" {
+				opts.allow = ports
+			} else {
+				opts.deny = ports
+			}
+		case "--header":
+			opts.header = true
+		case "-b", "--bind":
+			opts.bind = value()
+			if net.ParseIP(opts.bind) == nil {
+				fmt.Fprintln(os.Stderr, red+"Error: --bind requires an IP address"+reset)
+				os.Exit(1)
+			}
+		case "-H", "--host":
+			opts.host = value()
+		case "--port-timeout":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --port-timeout duration"+reset)
+				os.Exit(1)
+			}
+			opts.portTimeout = d
+		case "--min-port", "--max-port":
+			port, err := parsePort(value())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%sError: %s takes a port%s\n", red, arg, reset)
+				os.Exit(1)
+			}
+			if arg == "--min-port" {
+				opts.minPort = port
+			} else {
+				opts.maxPort = port
+			}
+		case "--strict":
+			opts.strict = true
+		case "--pid-timeout":
+			d, err := time.ParseDuration(value())
+			if err != nil || d < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --pid-timeout duration"+reset)
+				os.Exit(1)
+			}
+			opts.pidTimeout = d
+		case "--randomize":
+			opts.randomize = true
+		case "--unix":
+			opts.unix = true
+		case "--unix-socket":
+			opts.unixSocket = value()
+		case "--human":
+			opts.human = true
+		case "--pid-max-scan":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --pid-max-scan must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.pidMaxScan = n
+		case "--deadline":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --deadline duration"+reset)
+				os.Exit(1)
+			}
+			opts.deadline = d
+		case "--max-runtime":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --max-runtime duration"+reset)
+				os.Exit(1)
+			}
+			opts.maxRuntime = d
+		case "--targets-json":
+			opts.targetsJSON = value()
+		case "--cidr":
+			opts.cidr = value()
+		case "--listen-retries":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: --listen-retries must be zero or more"+reset)
+				os.Exit(1)
+			}
+			opts.listenRetries = n
+		case "-c", "--concurrency":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --concurrency must be at least 1"+reset)
+				os.Exit(1)
+			}
+			opts.concurrency = n
+		case "--debug-proc":
+			// Undocumented: a diagnostic dump of /proc/net for one port.
+			port, err := parsePort(value())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, red+"Error: --debug-proc takes a port"+reset)
+				os.Exit(1)
+			}
+			opts.debugProc = port
+		case "--source-port":
+			port, err := parsePort(value())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, red+"Error: --source-port must be a port number"+reset)
+				os.Exit(1)
+			}
+			opts.sourcePort = port
+		case "--wait-count":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --wait-count must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.waitCount = n
+		case "--find-free-n":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --find-free-n must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.findFreeN = n
+		case "--daemon":
+			opts.daemon = true
+		case "--wait-open":
+			opts.waitOpen = true
+		case "--then":
+			opts.then = value()
+		case "--family":
+			switch f := value(); f {
+			case "4", "ipv4":
+				opts.family = "4"
+			case "6", "ipv6":
+				opts.family = "6"
+			default:
+				fmt.Fprintln(os.Stderr, red+"Error: --family must be 4 or 6"+reset)
+				os.Exit(1)
+			}
+		case "--ramp":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --ramp duration"+reset)
+				os.Exit(1)
+			}
+			opts.ramp = d
+		case "--compare":
+			opts.compare = value()
+		case "--compare-format":
+			opts.compareFormat = value()
+			if opts.compareFormat != "text" && opts.compareFormat != "json" {
+				fmt.Fprintln(os.Stderr, red+"Error: --compare-format must be text or json"+reset)
+				os.Exit(1)
+			}
+		case "--throttle-on-error":
+			opts.throttleErrors = true
+		case "-y", "--yes":
+			opts.yes = true
+		case "--force":
+			opts.force = true
+		case "--from":
+			opts.from = value()
+		case "--stability":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --stability must be at least 1"+reset)
+				os.Exit(1)
+			}
+			opts.stability = n
+		case "--no-sort":
+			opts.noSort = true
+		case "--blocks":
+			opts.blocks = true
+		case "--fingerprint":
+			opts.fingerprint = true
+		case "--proxy":
+			p, err := parseProxy(value())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+				os.Exit(1)
+			}
+			opts.proxy = p
+		case "--assert-open", "--assert-closed":
+			if opts.assert != "" && opts.assert != arg {
+				fmt.Fprintln(os.Stderr, red+"Error: --assert-open and --assert-closed are mutually exclusive"+reset)
+				os.Exit(1)
+			}
+			opts.assert = arg
+		case "--ascii":
+			opts.ascii = true
+		case "--symbol-open":
+			opts.symbolOpen = value()
+		case "--symbol-closed":
+			opts.symbolClosed = value()
+		case "--merge-protocols":
+			opts.mergeProtocols = true
+		case "--connect":
+			opts.connect = true
+		case "--count-processes":
+			opts.countProcs = true
+		case "--sla":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --sla duration"+reset)
+				os.Exit(1)
+			}
+			opts.sla = d
+		case "--fail-on-slow":
+			opts.failOnSlow = true
+		case "--udp-probe":
+			opts.udpProbe = true
+		case "--identify":
+			opts.identify = true
+		case "--fail-fast":
+			opts.failFast = true
+		case "--retries":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: --retries must be zero or more"+reset)
+				os.Exit(1)
+			}
+			opts.retries = n
+		case "--retry-budget":
+			n, err := strconv.ParseInt(value(), 10, 64)
+			if err != nil || n <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: --retry-budget must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.retryBudget = n
+		case "-i", "--interval":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --interval duration"+reset)
+				os.Exit(1)
+			}
+			opts.interval = d
+		case "--time-format":
+			opts.timeFormat = timeLayout(value())
+		case "--alert-on":
+			opts.alertOn = value()
+			if !slices.Contains([]string{"open", "close", "any"}, opts.alertOn) {
+				fmt.Fprintln(os.Stderr, red+"Error: --alert-on must be open, close or any"+reset)
+				os.Exit(1)
+			}
+		case "--tcp-keepalive":
+			opts.tcpKeepalive = true
+		case "--ignore-loopback":
+			opts.ignoreLoopback = true
+		case "--only-process":
+			opts.onlyProcess = value()
+		case "--exact":
+			opts.exact = true
+		case "--since":
+			d, err := time.ParseDuration(value())
+			if err != nil || d <= 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --since duration"+reset)
+				os.Exit(1)
+			}
+			opts.since = d
+		case "--limit-open":
+			n, err := strconv.ParseInt(value(), 10, 64)
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --limit-open must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.limitOpen = n
+		case "--no-warnings", "--quiet-errors":
+			opts.noWarnings = true
+		case "--color":
+			colorMode = value()
+		case "--no-color":
+			colorMode = "never"
+		case "--passes":
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, red+"Error: --passes must be a positive number"+reset)
+				os.Exit(1)
+			}
+			opts.passes = n
+		case "--pass-interval":
+			d, err := time.ParseDuration(value())
+			if err != nil || d < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --pass-interval duration"+reset)
+				os.Exit(1)
+			}
+			opts.passInterval = d
+		case "--jitter":
+			d, err := time.ParseDuration(value())
+			if err != nil || d < 0 {
+				fmt.Fprintln(os.Stderr, red+"Error: Invalid --jitter duration"+reset)
+				os.Exit(1)
+			}
+			opts.jitter = d
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Fprintln(os.Stderr, red+"Error: Unknown flag "+arg+reset)
+				os.Exit(1)
+			}
+			if portArg != "" {
+				fmt.Fprintln(os.Stderr, red+"Error: Only one port or range may be given"+reset)
+				os.Exit(1)
+			}
+			portArg = arg
+		}
+	}
+	// The port argument as given, which the --header flags leave out;
+	// portArg is resolved below (ephemeral, --all, --min-port/--max-port).
+	givenPortArg := portArg
 
-	if os.Args[1] == "--pid" || os.Args[1] == "-p" {
-		if len(os.Args) < 3 {
-			fmt.Println(red + "Error: --pid requires a port number" + reset)
+	if opts.appendOutput && opts.output == "" {
+		fmt.Fprintln(os.Stderr, red+"Error: --append requires --output"+reset)
+		os.Exit(1)
+	}
+	if opts.outputFD > 0 {
+		if opts.output != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: --output and --output-fd are mutually exclusive"+reset)
+			os.Exit(1)
+		}
+		// Like --output, before setColor.
+		if err := redirectFD(opts.outputFD); err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+			os.Exit(1)
+		}
+	}
+	if opts.output != "" {
+		// Before setColor, so that "auto" sees the file rather than the
+		// terminal.
+		if err := redirectOutput(opts.output, opts.appendOutput); err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
 			os.Exit(1)
 		}
-		showPID, portArg = true, os.Args[2]
+		if opts.appendOutput {
+			// Each run needs a timestamp to tell it apart from the others.
+			opts.header = true
+		}
 	}
 
-	if portArg == "-h" || portArg == "--help" {
+	if !setColor(colorMode) {
+		fmt.Fprintln(os.Stderr, red+"Error: --color must be auto, always or never"+reset)
+		os.Exit(1)
+	}
+
+	if opts.ascii {
+		setASCII()
+	}
+	if opts.symbolOpen != "" {
+		symbolOpen = opts.symbolOpen
+	}
+	if opts.symbolClosed != "" {
+		symbolClosed = opts.symbolClosed
+	}
+
+	if help {
 		printUsage()
 		os.Exit(0)
 	}
 
-	if strings.Contains(portArg, "-") {
-		parts := strings.Split(portArg, "-")
-		if len(parts) != 2 {
-			fmt.Println(red + "Error: Invalid port range format" + reset)
+	if opts.verbose {
+		ipv6 := "unavailable"
+		if hasIPv6 {
+			ipv6 = "available"
+		}
+		out := os.Stdout
+		if machineReadable() {
+			out = os.Stderr // keep stdout machine-readable
+		}
+		fmt.Fprintf(out, "%sIPv6 support: %s%s\n", cyan, ipv6, reset)
+	}
+
+	if opts.daemon && command != "" {
+		fmt.Fprintln(os.Stderr, red+"Error: --daemon is used without a subcommand"+reset)
+		os.Exit(1)
+	}
+	for _, flag := range flagsUsed {
+		if owners, ok := commandFlags[flag]; ok && !slices.Contains(owners, command) && !(opts.daemon && slices.Contains(owners, "--daemon")) {
+			owners = slices.DeleteFunc(slices.Clone(owners), func(c string) bool { return c == "" })
+			fmt.Fprintf(os.Stderr, "%sError: %s is only valid with: %s%s\n", red, flag, strings.Join(owners, ", "), reset)
+			os.Exit(1)
+		}
+	}
+
+	if portArg == "ephemeral" {
+		lo, hi, ok := ephemeralRange()
+		if !ok {
+			fmt.Fprintln(os.Stderr, red+"Error: ephemeral needs the range in /proc/sys/net/ipv4/ip_local_port_range, which could not be read"+reset)
+			os.Exit(1)
+		}
+		if opts.host != "" {
+			warn("ephemeral is this machine's range (%d-%d); %s may use another", lo, hi, opts.host)
+		}
+		portArg = fmt.Sprintf("%d-%d", lo, hi)
+	}
+
+	switch command {
+	case "doctor":
+		if portArg != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: doctor takes no port argument"+reset)
+			os.Exit(1)
+		}
+		doctor()
+		return
+	case "alloc":
+		if portArg != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: alloc takes no port argument; the kernel picks one"+reset)
+			os.Exit(1)
+		}
+		// --hold defaults to 1s for check; alloc only holds when asked.
+		hold := slices.Contains(flagsUsed, "--hold")
+		if opts.printFD && !hold {
+			fmt.Fprintln(os.Stderr, red+"Error: alloc --fd needs --hold, or the socket closes before anything can take it over"+reset)
+			os.Exit(1)
+		}
+		alloc(hold)
+		return
+	case "info":
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: info takes a single port: "+parseErrorMessage(err)+reset)
+			os.Exit(1)
+		}
+		info(port)
+		return
+	case "status":
+		if portArg != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: status takes no port argument"+reset)
+			os.Exit(1)
+		}
+		opts.status = true
+	case "healthcheck":
+		// Probes want a fast answer; keep the 2s default for everything else.
+		if !slices.Contains(flagsUsed, "--port-timeout") {
+			opts.portTimeout = time.Second
+		}
+		fallthrough
+	case "check", "watch", "free":
+		if strings.ContainsAny(portArg, "-+,") {
+			fmt.Fprintf(os.Stderr, "%sError: %s takes a single port, not a range%s\n", red, command, reset)
+			os.Exit(1)
+		}
+	case "scan":
+		if portArg != "" && !strings.ContainsAny(portArg, "-+,") {
+			fmt.Fprintln(os.Stderr, red+"Error: scan takes a range like 3000-3010, 8080+10 or 22,80,443"+reset)
+			os.Exit(1)
+		}
+	}
+
+	if opts.onlyProcess != "" && !showPID && !opts.status {
+		fmt.Fprintln(os.Stderr, red+"Error: --only-process needs --pid or status to know each port's process"+reset)
+		os.Exit(1)
+	}
+
+	if opts.servicesFile != "" {
+		if err := loadServices(); err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+			os.Exit(1)
+		}
+	}
+
+	if opts.all {
+		if portArg != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: --all replaces the port argument"+reset)
+			os.Exit(1)
+		}
+		portArg = "1-65535"
+	}
+
+	if opts.blocks && opts.noSort {
+		fmt.Fprintln(os.Stderr, red+"Error: --blocks needs the results in port order and cannot be combined with --no-sort"+reset)
+		os.Exit(1)
+	}
+
+	if opts.minPort > opts.maxPort {
+		fmt.Fprintln(os.Stderr, red+"Error: --min-port is above --max-port"+reset)
+		os.Exit(1)
+	}
+	if opts.strict && !slices.Contains(flagsUsed, "--min-port") && !slices.Contains(flagsUsed, "--max-port") {
+		fmt.Fprintln(os.Stderr, red+"Error: --strict needs --min-port or --max-port"+reset)
+		os.Exit(1)
+	}
+	if portArg != "" && portArg != "0" && (opts.minPort > 1 || opts.maxPort < 65535) {
+		clamped, err := clampPortArg(portArg)
+		var perr *ParseError
+		switch {
+		case errors.As(err, &perr):
+			// Malformed arguments are reported by each mode as usual.
+		case err != nil:
+			fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+			os.Exit(1)
+		default:
+			portArg = clamped
+		}
+	}
+
+	if opts.then != "" && !opts.waitOpen && opts.waitCount == 0 && opts.alertOn == "" {
+		fmt.Fprintln(os.Stderr, red+"Error: --then runs a command after --wait-open or --wait-count succeeds or --alert-on fires and needs one of them"+reset)
+		os.Exit(1)
+	}
+
+	if opts.debugProc > 0 {
+		debugProc(opts.debugProc)
+		return
+	}
+
+	if (opts.unix || opts.unixSocket != "") && machineReadable() && !opts.json {
+		fmt.Fprintln(os.Stderr, red+"Error: Unix sockets can be listed as text or --json"+reset)
+		os.Exit(1)
+	}
+	if opts.unixSocket != "" {
+		if portArg != "" || opts.host != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: --unix-socket checks a local socket path and takes no port or --host"+reset)
+			os.Exit(1)
+		}
+		checkUnixSocket(opts.unixSocket)
+		return
+	}
+
+	if opts.compare != "" && (portArg != "" || opts.from != "" || opts.targetsJSON != "" || machineReadable()) {
+		fmt.Fprintln(os.Stderr, red+"Error: --compare re-checks the targets of a saved scan and takes no port argument or other input or output format"+reset)
+		os.Exit(1)
+	}
+	if opts.compareFormat != "" && opts.compare == "" {
+		fmt.Fprintln(os.Stderr, red+"Error: --compare-format needs --compare"+reset)
+		os.Exit(1)
+	}
+	if opts.from != "" && portArg != "" {
+		fmt.Fprintln(os.Stderr, red+"Error: --from replays a saved scan and takes no port argument"+reset)
+		os.Exit(1)
+	}
+
+	if portArg == "" && !opts.fromListening && !opts.status && opts.targetsJSON == "" && opts.from == "" && opts.compare == "" {
+		if showPID {
+			fmt.Fprintln(os.Stderr, red+"Error: --pid requires a port number"+reset)
+		} else {
+			printUsage()
+		}
+		os.Exit(1)
+	}
+
+	if opts.host != "" && (showPID || opts.bind != "" || opts.fromListening || opts.status) {
+		fmt.Fprintln(os.Stderr, red+"Error: --host cannot be combined with --pid, --bind or listening modes"+reset)
+		os.Exit(1)
+	}
+	if opts.proxy != nil && (opts.host == "" && opts.targetsJSON == "" && opts.cidr == "" || opts.udp) {
+		fmt.Fprintln(os.Stderr, red+"Error: --proxy applies to TCP checks of remote hosts (--host, --cidr or --targets-json)"+reset)
+		os.Exit(1)
+	}
+	if opts.columns != nil && !opts.csv && !opts.status {
+		fmt.Fprintln(os.Stderr, red+"Error: --columns applies to --csv and the status table"+reset)
+		os.Exit(1)
+	}
+	if opts.throttleErrors && (opts.ramp > 0 || opts.host == "") {
+		fmt.Fprintln(os.Stderr, red+"Error: --throttle-on-error applies to --host scans and cannot be combined with --ramp"+reset)
+		os.Exit(1)
+	}
+	if opts.sourcePort > 0 && (opts.proxy != nil || opts.host == "" && !opts.connect && opts.cidr == "" && opts.targetsJSON == "" && command != "healthcheck") {
+		fmt.Fprintln(os.Stderr, red+"Error: --source-port applies to connections made directly: --host, --connect, --cidr, --targets-json or healthcheck, without --proxy"+reset)
+		os.Exit(1)
+	}
+	if opts.mergeProtocols && opts.targetsJSON == "" {
+		fmt.Fprintln(os.Stderr, red+"Error: --merge-protocols applies to --targets-json, whose targets can name both protocols"+reset)
+		os.Exit(1)
+	}
+	if opts.udpProbe && (opts.host == "" || !opts.udp) {
+		fmt.Fprintln(os.Stderr, red+"Error: --udp-probe needs --udp and --host"+reset)
+		os.Exit(1)
+	}
+	if opts.pidMaxScan > 0 && (!showPID || opts.status || !opts.fromListening && !strings.ContainsAny(portArg, ",-+")) {
+		fmt.Fprintln(os.Stderr, red+"Error: --pid-max-scan applies to --pid on a range or list of ports, whose owners are looked up in one walk"+reset)
+		os.Exit(1)
+	}
+	if opts.unix && !opts.status {
+		fmt.Fprintln(os.Stderr, red+"Error: --unix applies to status, which it switches to Unix sockets"+reset)
+		os.Exit(1)
+	}
+	if opts.countProcs && !showPID && !opts.status {
+		fmt.Fprintln(os.Stderr, red+"Error: --count-processes needs --pid, or status, to know the owning processes"+reset)
+		os.Exit(1)
+	}
+	if opts.sla > 0 && (opts.host == "" && !opts.connect && opts.targetsJSON == "" || opts.udp) {
+		fmt.Fprintln(os.Stderr, red+"Error: --sla applies to TCP connections: --host, --connect or --targets-json"+reset)
+		os.Exit(1)
+	}
+	if opts.failOnSlow && opts.sla == 0 {
+		fmt.Fprintln(os.Stderr, red+"Error: --fail-on-slow needs --sla"+reset)
+		os.Exit(1)
+	}
+	if opts.connect && (opts.host != "" || opts.udp || opts.bind != "" || opts.cidr != "") {
+		fmt.Fprintln(os.Stderr, red+"Error: --connect checks local TCP ports; it cannot be combined with --host, --udp, --bind or --cidr"+reset)
+		os.Exit(1)
+	}
+	if opts.cidr != "" && (opts.host != "" || showPID || opts.udp || opts.bind != "") {
+		fmt.Fprintln(os.Stderr, red+"Error: --cidr cannot be combined with --host, --pid, --udp or --bind"+reset)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	if opts.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.deadline)
+		defer cancel()
+	}
+	if opts.maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = limitRuntime(ctx, opts.maxRuntime)
+		defer cancel()
+		defer exitIfAborted()
+	}
+
+	if opts.host != "" && opts.proxy == nil && command != "healthcheck" {
+		// Through a proxy, the name is resolved on the far side; probes
+		// keep their silent 0-or-1 contract.
+		requireResolvable(ctx, opts.host)
+	}
+	if opts.sourcePort > 0 {
+		checkSourcePort(opts.sourcePort)
+	}
+
+	limitConcurrency(slices.Contains(flagsUsed, "--concurrency") || slices.Contains(flagsUsed, "-c"))
+
+	if opts.header {
+		target := portArg
+		if opts.fromListening || opts.status {
+			target = "listening"
+		} else if opts.targetsJSON != "" {
+			target = opts.targetsJSON
+		} else if opts.cidr != "" {
+			target = opts.cidr + " port " + portArg
+		}
+		header = newHeader(target, givenPortArg)
+		if !machineReadable() {
+			fmt.Println(header)
+		}
+	}
+
+	if opts.daemon {
+		if machineReadable() || opts.cidr != "" || opts.fromListening || opts.from != "" || opts.compare != "" {
+			fmt.Fprintln(os.Stderr, red+"Error: --daemon monitors a port argument or --targets-json, with text output"+reset)
+			os.Exit(1)
+		}
+		runDaemon(ctx, portArg, showPID)
+		return
+	}
+
+	if opts.fromListening {
+		checkListening(showPID)
+		return
+	}
+	if opts.status {
+		showStatus()
+		return
+	}
+	if opts.targetsJSON != "" {
+		checkTargetsFile(ctx, opts.targetsJSON)
+		return
+	}
+	if opts.from != "" {
+		replayScan(opts.from)
+		return
+	}
+	if opts.compare != "" {
+		compareScan(ctx, opts.compare)
+		return
+	}
+
+	if opts.cidr != "" {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: --cidr takes a single port"+reset)
+			os.Exit(1)
+		}
+		checkCIDR(ctx, opts.cidr, port)
+		return
+	}
+
+	if opts.checkBindable {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: --check-bindable takes a single port"+reset)
+			os.Exit(1)
+		}
+		if opts.backlog > 0 && opts.udp {
+			fmt.Fprintln(os.Stderr, red+"Error: --backlog only applies to TCP listeners"+reset)
+			os.Exit(1)
+		}
+		reservePort(port)
+		return
+	}
+
+	if opts.assert != "" {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %s takes a single port%s\n", red, opts.assert, reset)
+			os.Exit(1)
+		}
+		assertPort(ctx, port, opts.assert == "--assert-open")
+	}
+
+	if opts.waitOpen {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: --wait-open takes a single port"+reset)
+			os.Exit(1)
+		}
+		waitOpen(ctx, port)
+		return
+	}
+
+	if opts.waitCount > 0 {
+		ports, err := parsePortList(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
+			os.Exit(1)
+		}
+		if opts.waitOpen || opts.waitCount > len(ports) {
+			fmt.Fprintf(os.Stderr, "%sError: --wait-count needs a range of at least %d ports, without --wait-open%s\n", red, opts.waitCount, reset)
+			os.Exit(1)
+		}
+		waitCount(ctx, ports, opts.waitCount, showPID)
+		return
+	}
+
+	if opts.findFreeN > 0 {
+		ports, err := parsePortList(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
+			os.Exit(1)
+		}
+		if opts.host != "" || machineReadable() {
+			fmt.Fprintln(os.Stderr, red+"Error: --find-free-n checks local ports and prints plain port numbers"+reset)
+			os.Exit(1)
+		}
+		findFree(ctx, ports, opts.findFreeN)
+		return
+	}
+
+	if command == "free" {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
+			os.Exit(1)
+		}
+		freePort(ctx, port)
+		return
+	}
+
+	if command == "healthcheck" {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
+			os.Exit(1)
+		}
+		healthcheck(ctx, port)
+	}
+
+	if command == "watch" {
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
+			os.Exit(1)
+		}
+		if machineReadable() {
+			fmt.Fprintln(os.Stderr, red+"Error: watch only supports text output"+reset)
+			os.Exit(1)
+		}
+		watchPort(ctx, port, showPID)
+		return
+	}
+
+	if strings.Contains(portArg, ",") {
+		ports, err := parsePortList(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
 			os.Exit(1)
 		}
-		start, err1 := strconv.Atoi(parts[0])
-		end, err2 := strconv.Atoi(parts[1])
-		if err1 != nil || err2 != nil || start > end || start < 1 || end > 65535 {
-			fmt.Println(red + "Error: Invalid port range" + reset)
+		if opts.dedupe {
+			ports = dedupePorts(ports)
+		}
+		checkPortList(ctx, ports, portArg, showPID)
+	} else if strings.ContainsAny(portArg, "-+") {
+		start, end, err := parseRange(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
 			os.Exit(1)
 		}
-		checkPortRange(start, end, showPID)
+		checkPortRange(ctx, start, end, showPID)
+	} else if portArg == "0" {
+		// Binding port 0 asks the kernel for any free ephemeral port, so
+		// checking it means nothing; say where such ports come from instead.
+		printEphemeralRange()
 	} else {
-		port, err := strconv.Atoi(portArg)
-		if err != nil || port < 1 || port > 65535 {
-			fmt.Println(red + "Error: Invalid port number" + reset)
+		port, err := parsePort(portArg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red+"Error: "+parseErrorMessage(err)+reset)
 			os.Exit(1)
 		}
-		printResult(checkPort(port, showPID), showPID)
+		warnPrivileged(port)
+		startTime := time.Now()
+		var result PortResult
+		if opts.host != "" && !opts.udp && opts.proxy == nil {
+			// Through a proxy, only the proxy knows the host's addresses.
+			result = checkFamilies(ctx, opts.host, port)
+		} else {
+			result = checkPort(ctx, port, showPID)
+		}
+		applySLA(&result)
+		if machineReadable() {
+			exitReport([]PortResult{result}, time.Since(startTime))
+		}
+		printResult(result, showPID)
+		enforcePolicy([]PortResult{result})
+		exitIfSlow([]PortResult{result})
+	}
+}
+
+// commands are the subcommands accepted as the first argument.
+var commands = []string{"check", "scan", "watch", "status", "healthcheck", "free", "doctor", "info", "alloc"}
+
+func isCommand(arg string) bool {
+	return slices.Contains(commands, arg)
+}
+
+// commandFlags lists the flags that belong to particular subcommands. Using
+// one with a different subcommand is an error; the flat legacy interface
+// (no subcommand) still accepts them, except the watch and free flags, which
+// only mean something to those commands. "--daemon" as an owner admits a
+// flag in the flat interface when --daemon is given. Flags not listed here
+// are shared by every command.
+var commandFlags = map[string][]string{
+	"--interval":        {"watch", "--daemon"},
+	"--time-format":     {"watch", "--daemon"},
+	"--alert-on":        {"watch"},
+	"-i":                {"watch", "--daemon"},
+	"--yes":             {"free"},
+	"-y":                {"free"},
+	"--force":           {"free"},
+	"--host":            {"check", "scan", "watch", "healthcheck", ""},
+	"-H":                {"check", "scan", "watch", "healthcheck", ""},
+	"--since":           {"status", ""},
+	"--ignore-loopback": {"status", ""},
+	"--tcp-keepalive":   {"status", ""},
+	"--unix":            {"status", ""},
+	"--count-by-state":  {"scan", ""},
+	"--sample":          {"scan", ""},
+	"--seed":            {"scan", ""},
+	"--randomize":       {"scan", ""},
+	"--all":             {"scan", ""},
+	"-a":                {"scan", ""},
+	"--hold":            {"check", "alloc", ""},
+	"--fd":              {"check", "alloc", ""},
+	"--check-bindable":  {"check", ""},
+	"--backlog":         {"check", ""},
+	"--jitter":          {"scan", ""},
+	"--passes":          {"scan", ""},
+	"--pass-interval":   {"scan", ""},
+	"--limit-open":      {"scan", ""},
+	"--find-free-n":     {"scan", ""},
+}
+
+// setColor applies a --color mode. auto keeps ANSI colors only when stdout
+// is a terminal; always keeps them even when piped (e.g. into less -R).
+func setColor(mode string) bool {
+	switch mode {
+	case "always":
+	case "never":
+		reset, red, green, yellow, cyan, bold = "", "", "", "", "", ""
+	case "auto":
+		if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			reset, red, green, yellow, cyan, bold = "", "", "", "", "", ""
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// flagValue returns the argument following the flag at os.Args[*i] and
+// advances i past it, exiting if the value is missing.
+func flagValue(i *int, flag string) string {
+	if *i+1 >= len(os.Args) {
+		fmt.Fprintln(os.Stderr, red+"Error: "+flag+" requires a value"+reset)
+		os.Exit(1)
 	}
+	*i++
+	return os.Args[*i]
 }
 
 func printUsage() {
 	fmt.Printf(`%s%sportcheck%s - Check if ports are open/in use
 
+%sCommands:%s
+  portcheck check <port>     Check a single port
+  portcheck scan <range>     Check a range of ports (3000-3010 or 8080+10)
+  portcheck watch <port>     Re-check a port every --interval and report changes
+  portcheck status           List every listening port and its process
+  portcheck free <port>      Stop the process holding a port (asks first
+                             unless --yes) and confirm the port is free
+  portcheck healthcheck <port>
+                             Exit 0 if the port accepts a connection within
+                             1s, 1 otherwise, printing nothing (for probes)
+  portcheck doctor           Check what portcheck can see on this system
+  portcheck alloc            Bind port 0 and print the free port the kernel
+                             assigned (--hold keeps it bound for a while)
+  portcheck info <port>      Show a port's service, IANA category and
+                             description without checking it
+
 %sUsage:%s
   portcheck <port>           Check a single port
   portcheck <start>-<end>    Check a range of ports
+  portcheck <start>+<count>  Check start through start+count
+  portcheck <list>           Check a comma-separated list like 22,80,8000-8100
+  portcheck 0                Show the kernel's ephemeral port range
+  portcheck ephemeral        Check every port in the ephemeral range
   portcheck --pid <port>     Show process using the port
+  portcheck --ports-from-listening
+                             Re-verify every port the kernel reports as listening
 
 %sExamples:%s
   portcheck 8080             Check if port 8080 is in use
   portcheck 3000-3010        Scan ports 3000 through 3010
+  portcheck 8080+10          Scan ports 8080 through 8090
   portcheck --pid 22         Show what's using port 22
 
 %sFlags:%s
-  -p, --pid    Show process ID and name using the port
-  -h, --help   Show this help message
-`, bold, cyan, reset, yellow, reset, yellow, reset, yellow, reset)
+  -p, --pid       Show process ID and name using the port
+  -v, --verbose   Show environment details before the results
+  --full-command  With --pid, show the full command line of the process
+  --resolve       Name the service of every port shown, e.g. 443 (https), not
+                  only of the ones in use
+  --wrap <cols>   Cut command lines in text output to fit cols columns
+                  (default: the terminal width; 0 for no limit)
+  --tree          With --pid, show the chain of parent processes up to init
+  --jitter <d>    Delay each range check by a random 0..d (e.g. 20ms)
+  -u, --udp       Check UDP ports instead of TCP
+  -j, --json      Print results as JSON (exits 1 if any port is in use)
+  -g, --grepable  Print results in nmap's grepable format
+  -o, --output <file>
+                  Write results to file instead of stdout
+  --append        With --output, add to the file instead of replacing it;
+                  each run starts with a --header line (except --csv, which
+                  pairs with --no-header), and --json writes one line per run
+  --output-fd <n> Write results to open file descriptor n instead of stdout
+  --csv           Print results as CSV, one row per port
+  --columns <list>
+                  Choose the columns, in order, of --csv and the status
+                  table (e.g. port,status,pid,process,service)
+  --no-header     With --csv, leave out the column header row (for --append)
+  --from <file>   Re-render a report saved with --json in another format,
+                  without checking anything
+  --compare <file>
+                  Check the targets of a report saved with --json again and
+                  list the ports that opened, closed or changed process;
+                  exits 1 if any did
+  --compare-format <text|json>
+                  With --compare, print the changes as text (default) or as
+                  a JSON object of opened, closed and process_changed
+  --yaml          Print results as YAML, with the same fields and exit code
+                  as --json
+  --count-by-state
+                  Break the range summary down by socket state (LISTEN, ...)
+  --sample <k>    Check only k randomly chosen ports of a range
+  --randomize     Check the ports in random order, so the traffic doesn't
+                  walk the range; results are still listed by port
+  --seed <n>      Seed the --sample choice and --randomize order for
+                  reproducible runs
+  -a, --all       Scan every port, 1-65535, printing results as they arrive
+  --no-sort       Print range results as they complete instead of in port
+                  order; the summary counts are unaffected
+  --blocks        Print runs of consecutive in-use ports held by the same
+                  process as one line, e.g. 8000-8007 (8 consecutive)
+  --fingerprint   End a range scan with a hash of the in-use ports (and, with
+                  --pid, their processes) that changes only when they do
+  --check-bindable
+                  Bind the port and hold it for --hold (default 1s) before
+                  reporting it free
+  --backlog <n>   Hold the port like --check-bindable with a listen backlog
+                  of n, and report the backlog the kernel actually allows
+  --fd            With --check-bindable, or alloc --hold, print the held
+                  socket's fd and pid
+  --services-file <file>
+                  Name ports from a file of "port name" lines, on top of
+                  /etc/services and the built-in names
+  --dedupe        Check and report each port once when targets overlap
+  --allow <list>  Exit 1 if any in-use port is not in the list (22,80,8000-8100)
+  --deny <list>   Exit 1 if any port in the list is in use
+  --min-port <p>, --max-port <p>
+                  Drop target ports outside p..p before checking anything
+  --strict        With --min-port or --max-port, fail instead of dropping
+  --header        Record the time, targets and flags before the results
+  --passes <n>    Spread a range scan over n passes
+  --pass-interval <d>
+                  Wait d between passes (e.g. 2s)
+  -b, --bind <ip> Check the port on a specific local address
+  --connect       Check local TCP ports by connecting on loopback instead of
+                  binding: refused means available, a timeout filtered
+  --sla <d>       With --host, --connect or --targets-json, report ports that
+                  took longer than d to accept the connection as slow
+  --fail-on-slow  With --sla, exit 1 if any port was slow
+  --count-processes
+                  With --pid on a range or --ports-from-listening, or status,
+                  count the distinct processes owning the in-use ports
+  -H, --host <h>  Check ports on a remote host by connecting to them
+  --port-timeout <d>
+                  With --host, give up on each connection after d (default 2s)
+  --deadline <d>  Stop the whole scan after d; unchecked ports are reported
+  --source-port <n>
+                  Make connections from local port n, to test firewall rules
+                  that match on source port (not with --proxy)
+  --proxy <url>   Connect to remote hosts through a SOCKS5 proxy, given as
+                  socks5://[user:pass@]host:port (e.g. an ssh -D forward)
+  --udp-probe     With --udp and --host, send DNS, NTP and SNMP ports a
+                  request their service answers instead of an empty datagram
+  --identify      With --host, guess whether each open port speaks HTTP, TLS,
+                  SSH, FTP or SMTP from a short probe
+  --fail-fast     With --cidr or --targets-json, stop and exit 1 at the first
+                  target found closed or unreachable
+  --find-free-n <k>
+                  Print the first k available ports of the range, one per
+                  line; exit 1 if there are fewer
+  --daemon        Re-check the targets (a port argument or --targets-json)
+                  every --interval until SIGTERM, logging each change; SIGHUP
+                  re-reads --targets-json
+  --assert-open, --assert-closed
+                  Check one port, print PASS or FAIL and exit 0 only if it is
+                  in use or open (or available or closed), for CI scripts
+  --wait-open     Wait until the port is in use (or open, with --host); bound
+                  the wait with --deadline
+  --wait-count <n>
+                  Wait until at least n ports of the range are in use (or
+                  open, with --host), then list them; bound with --deadline.
+                  With --json and the like, reports the last full pass
+  --then <cmd>    With --wait-open, --wait-count or --alert-on, run cmd
+                  through the shell once the wait ends and exit with its
+                  status
+  --family <4|6>  With --host, connect over IPv4 or IPv6 only. Without it, a
+                  single port on a dual-stack host is checked over both
+  --retries <n>   With --host, retry a connection that timed out or failed
+                  (not one that was refused) up to n times
+  --retry-budget <n>
+                  Cap the retries of the whole scan at n; once spent,
+                  failures are final
+  --pid-timeout <d>
+                  Give up looking for a port's process after d (default
+                  500ms, 0 to never give up)
+  --pid-max-scan <n>
+                  With --pid on a range or list, look through at most n
+                  processes for the ports' owners
+  --max-runtime <d>
+                  Abort after d whatever the mode, keeping the results so
+                  far, and exit 2
+  --targets-json <file>
+                  Check the hosts and ports listed in a JSON file
+  --merge-protocols
+                  With --targets-json, print one line per port listing the
+                  status of each protocol checked
+  --cidr <block>  Check the port on every host of a network (192.168.1.0/24)
+                  and list the hosts that have it open
+  -y, --yes       With free, don't ask before stopping the process
+  --force         With free, act on ports below 1024 too
+  -c, --concurrency <n>
+                  Run up to n checks at a time (default 100, lowered to fit
+                  the open-file limit)
+  --throttle-on-error
+                  With --host, halve the checks at a time and pause between
+                  them while over 20%% of the last 50 fail, speeding back up
+                  once under 5%%; --verbose shows each change
+  --ramp <d>      With --host, start at 4 checks at a time and double every d
+                  up to --concurrency, halving instead when over 10%% of the
+                  checks in an interval time out or fail
+  --stability <n> Check each port n times and report it unstable unless all
+                  n checks agree
+  --listen-retries <n>
+                  Retry a failed bind n times, 10ms apart, before reporting in use
+  -i, --interval <d>
+                  With watch or --daemon, time between checks (default 1s)
+  --time-format <f>
+                  With watch, timestamp events with f: rfc3339, unix, or a
+                  Go time layout (default 15:04:05.000, local time)
+  --alert-on <open|close|any>
+                  With watch, stop at the first change of that kind and exit
+                  0, or run --then; exits 1 if --deadline passes first
+  --unix          With status, list listening Unix domain sockets, including
+                  abstract ones (@name), instead of ports
+  --unix-socket <path|@name>
+                  Check whether anything listens on a Unix socket, and which
+                  process (-p); abstract sockets are written @name
+  --tcp-keepalive With status, show how many of each TCP listener's
+                  established connections have keepalive running
+  --since <d>     With status, only show ports of processes started within d
+  --only-process <name>
+                  With --pid or status, show only ports whose process name
+                  contains name
+  --exact         With --only-process, require the whole name to match
+  --ignore-loopback
+                  With status or --ports-from-listening, hide ports bound only
+                  to 127.0.0.1 or ::1
+  --limit-open <n>
+                  Stop a range scan once n in-use ports have been found
+  --no-warnings, --quiet-errors
+                  Don't print advisory warnings to stderr; errors that stop
+                  portcheck are still printed there. With --json or --yaml,
+                  warnings go into the summary's warnings list instead
+  --color <when>  Colorize output: auto (default), always or never
+  --no-color      Same as --color never
+  --human         Write large counts with separators (12,345) and durations
+                  rounded for reading (1.2s) in text summaries
+  --ascii         Print [X], [ ] and other ASCII markers instead of Unicode
+                  symbols, for terminals that can't show them
+  --symbol-open <s>, --symbol-closed <s>
+                  Mark in-use/open and available/closed ports with s
+  -h, --help      Show this help message
+`, bold, cyan, reset, yellow, reset, yellow, reset, yellow, reset, yellow, reset)
+}
+
+// checkPort checks a port on the --host, or locally, over the selected
+// protocol. It is the common single-port form of checkTarget.
+func checkPort(ctx context.Context, port int, getPID bool) PortResult {
+	return checkTarget(ctx, Target{Host: opts.host, Port: port, Protocol: protocol()}, getPID)
+}
+
+// checkTarget checks one target, remotely by connecting or locally by
+// binding. With --stability n it checks n times and marks the result
+// unstable if they disagree.
+func checkTarget(ctx context.Context, t Target, getPID bool) PortResult {
+	result := checkTargetOnce(ctx, t, getPID)
+	for i := 1; i < opts.stability && ctx.Err() == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if checkTargetOnce(ctx, t, false).InUse != result.InUse {
+			result.Unstable = true
+		}
+	}
+	applySLA(&result)
+	return result
 }
 
-func checkPort(port int, getPID bool) PortResult {
-	result := PortResult{Port: port}
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+func checkTargetOnce(ctx context.Context, t Target, getPID bool) PortResult {
+	if t.Host != "" && t.Protocol == "udp" {
+		return checkRemoteUDP(ctx, t.Host, t.Port)
+	}
+	if t.Host != "" {
+		return checkRemote(ctx, t.Host, t.Port)
+	}
+	if opts.connect {
+		return checkConnect(ctx, t.Port, getPID)
+	}
+	port := t.Port
+	result := PortResult{Port: port, Protocol: t.Protocol}
+	err := tryBind(result.Protocol, port)
+	for attempt := 0; err != nil && attempt < opts.listenRetries; attempt++ {
+		// A socket that was just closed can take a moment to be released.
+		time.Sleep(10 * time.Millisecond)
+		err = tryBind(result.Protocol, port)
+	}
 	if err != nil {
 		result.InUse = true
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			// Not a conflict (e.g. EACCES or EMFILE): the port may be free.
+			result.Err = err.Error()
+		}
+		if opts.bind != "" {
+			result.Wildcard = findWildcardListener(result.Protocol, port)
+		}
 		if getPID {
-			result.PID, result.Process = findProcessByPort(port)
+			findProcessByPort(&result)
+			if opts.fullCommand && result.PID > 0 {
+				result.Cmdline = readCmdline(result.PID)
+			}
 		}
-	} else {
-		listener.Close()
 	}
 	return result
 }
 
-func checkPortRange(start, end int, showPID bool) {
-	var wg sync.WaitGroup
-	results := make(chan PortResult, end-start+1)
-	sem := make(chan struct{}, 100)
+// Target returns the host, port and protocol the result is for.
+func (r PortResult) Target() Target {
+	return Target{Host: r.Host, Port: r.Port, Protocol: r.Protocol}
+}
 
-	fmt.Printf("%sScanning ports %d-%d...%s\n\n", cyan, start, end, reset)
-	startTime := time.Now()
+// checkRemote reports whether a port on a remote host accepts connections.
+func checkRemote(ctx context.Context, host string, port int) PortResult {
+	result := PortResult{Port: port, Protocol: "tcp", Host: host}
+	err := dialFallback(ctx, &result)
+	for attempt := 0; err != nil && attempt < opts.retries; attempt++ {
+		// A refusal is a definite answer; only timeouts and the like are
+		// worth another try.
+		if errors.Is(err, syscall.ECONNREFUSED) || ctx.Err() != nil || !takeRetry() {
+			break
+		}
+		err = dialFallback(ctx, &result)
+	}
+	result.InUse = err == nil
+	if err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+		// Only a refusal proves the port is closed; a timeout may be a filter.
+		result.Err = unresolvedError(host, err)
+	}
+	if opts.identify && result.InUse {
+		result.DetectedProto = identifyProtocol(ctx, host, port)
+	}
+	return result
+}
+
+// takeRetry claims one retry from the --retry-budget shared by the whole
+// scan, reporting false once it is spent. Without a budget it always
+// succeeds.
+func takeRetry() bool {
+	return opts.retryBudget == 0 || retriesUsed.Add(1) <= opts.retryBudget
+}
+
+// dialPort connects to a remote port. Each attempt is bounded by
+// --port-timeout and, through ctx, by the overall --deadline, whichever
+// comes first.
+func dialPort(ctx context.Context, host string, port int) error {
+	conn, err := dialTCP(ctx, host, port)
+	if err == nil {
+		closeFromSourcePort(conn)
+	}
+	return err
+}
+
+// dialTCP opens a connection to a remote port, through the --proxy if one
+// was given.
+func dialTCP(ctx context.Context, host string, port int) (net.Conn, error) {
+	if opts.proxy != nil {
+		return opts.proxy.dial(ctx, host, port)
+	}
+	dialer := newDialer("tcp")
+	return dialer.DialContext(ctx, dialNetwork("tcp"), net.JoinHostPort(host, strconv.Itoa(port)))
+}
 
+// protocol returns the transport protocol being checked.
+func protocol() string {
+	if opts.udp {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// tryBind attempts to bind the port on all interfaces, or on the --bind
+// address, and releases it immediately. A non-nil error means something
+// else holds the port.
+func tryBind(proto string, port int) error {
+	network := proto
+	if !hasIPv6 {
+		network += "4"
+	}
+	addr := net.JoinHostPort(opts.bind, strconv.Itoa(port))
+	if proto == "udp" {
+		conn, err := net.ListenPacket(network, addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	listener, err := net.Listen(network, addr)
+	if err == nil {
+		listener.Close()
+	}
+	return err
+}
+
+func checkPortRange(ctx context.Context, start, end int, showPID bool) {
+	ports := make([]int, 0, end-start+1)
 	for port := start; port <= end; port++ {
-		wg.Add(1)
-		go func(p int) {
-			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-			results <- checkPort(p, showPID)
-		}(port)
+		ports = append(ports, port)
 	}
+	checkPortList(ctx, ports, fmt.Sprintf("%d-%d", start, end), showPID)
+}
 
-	go func() { wg.Wait(); close(results) }()
+// checkPortList scans a list of ports, described by label in the progress
+// line, and prints the in-use ones followed by a summary.
+func checkPortList(ctx context.Context, ports []int, label string, showPID bool) {
+	rangeSize := len(ports)
+	if opts.sample > 0 && opts.sample < len(ports) {
+		ports = samplePorts(ports, opts.sample)
+	}
 
-	var portResults []PortResult
-	for r := range results {
-		portResults = append(portResults, r)
+	warnPrivileged(slices.Min(ports))
+	ctx, stop := interruptible(ctx)
+	defer stop()
+	if !machineReadable() {
+		fmt.Printf("%sScanning ports %s...%s\n\n", cyan, label, reset)
 	}
+	startTime := time.Now()
 
-	// Sort by port
-	for i := range portResults {
-		for j := i + 1; j < len(portResults); j++ {
-			if portResults[i].Port > portResults[j].Port {
-				portResults[i], portResults[j] = portResults[j], portResults[i]
+	var portResults []PortResult
+	scanned, inUse, filtered := 0, 0, 0
+	var latency latencyHistogram
+	if (opts.all || opts.noSort) && canStream(showPID) {
+		// Print as results arrive instead of holding them all in memory.
+		streamPorts(ctx, ports, func(r PortResult) {
+			scanned++
+			latency.add(r)
+			if r.InUse {
+				inUse++
 			}
+			if r.State == stateOpenFiltered {
+				filtered++
+			}
+			if r.InUse || r.Unstable || r.State == stateFiltered {
+				printResult(r, showPID)
+				// Kept for the policy check and the unstable count.
+				portResults = append(portResults, r)
+			}
+		})
+	} else {
+		portResults = scanInPasses(ctx, ports, showPID)
+		scanned = len(portResults)
+		if opts.onlyProcess != "" {
+			portResults = ownedBy(portResults, opts.onlyProcess)
+		}
+		if machineReadable() {
+			exitReport(portResults, time.Since(startTime))
+		}
+		for _, r := range portResults {
+			latency.add(r)
+			if r.InUse {
+				inUse++
+			}
+			if r.State == stateOpenFiltered {
+				filtered++
+			}
+			if (r.InUse || r.Unstable || r.State == stateFiltered) && !opts.blocks {
+				printResult(r, showPID)
+			}
+		}
+		if opts.blocks {
+			printBlocks(portResults, showPID)
 		}
 	}
 
-	inUse := 0
-	for _, r := range portResults {
-		if r.InUse {
-			inUse++
-			printResult(r, showPID)
+	usedWord, freeWord := "in use", "available"
+	if opts.host != "" {
+		usedWord, freeWord = "open", "closed"
+	}
+	if families := countFamilies(portResults); len(families) > 0 {
+		usedWord += " (" + formatFamilies(families) + ")"
+	}
+	note := ""
+	if interrupted.Load() {
+		note = " (interrupted)"
+	}
+	// The counts take the colors of the result markers: red in use, green
+	// available.
+	fmt.Printf("\n%s%s ports scanned in %s%s | %s", cyan, formatCount(scanned), formatElapsed(time.Since(startTime)), note, reset)
+	if opts.onlyProcess != "" {
+		fmt.Printf("%s%s used by %s%s\n", red, formatCount(inUse), opts.onlyProcess, reset)
+	} else {
+		fmt.Printf("%s%s %s%s%s, %s%s%s %s%s\n", red, formatCount(inUse), usedWord, reset, cyan, reset, green, formatCount(scanned-inUse), freeWord, reset)
+	}
+	if len(ports) < rangeSize {
+		fmt.Printf("%sRandom sample of %s out of %s ports in the range%s\n", cyan, formatCount(len(ports)), formatCount(rangeSize), reset)
+	}
+	if opts.verbose && opts.host != "" {
+		latency.print()
+	}
+	if filtered > 0 {
+		fmt.Printf("%s%d of the closed ports gave no reply, so may be open (open|filtered)%s\n", yellow, filtered, reset)
+	}
+	if unstable := countUnstable(portResults); unstable > 0 {
+		fmt.Printf("%s%d ports changed state between --stability checks%s\n", yellow, unstable, reset)
+	}
+	if slow := countSlow(portResults); slow > 0 {
+		fmt.Printf("%s%s open ports were slower than the --sla of %v%s\n", yellow, formatCount(slow), opts.sla, reset)
+	}
+	printProcessCount(portResults)
+	printFingerprint(portResults)
+	if opts.countByState && inUse > 0 {
+		fmt.Printf("%sBy state: %s%s\n", cyan, formatStates(countStates(portResults)), reset)
+	}
+	if opts.limitOpen > 0 && openSeen.Load() >= opts.limitOpen && scanned < len(ports) {
+		fmt.Printf("%sStopped early after finding %d in-use ports%s\n", yellow, opts.limitOpen, reset)
+	} else if ctx.Err() != nil {
+		reason := fmt.Sprintf("Deadline of %v reached", opts.deadline)
+		if interrupted.Load() {
+			reason = "Interrupted"
+		} else if aborted.Load() {
+			reason = fmt.Sprintf("Scan aborted after %v", opts.maxRuntime)
 		}
+		fmt.Printf("%s%s; %s ports were not checked%s\n", yellow, reason, formatCount(len(ports)-scanned), reset)
+	}
+	if opts.retryBudget > 0 && retriesUsed.Load() > opts.retryBudget {
+		fmt.Printf("%sRetry budget of %d used up; later failures were not retried%s\n", yellow, opts.retryBudget, reset)
 	}
+	stop()
+	exitIfInterrupted()
+	enforcePolicy(portResults)
+	exitIfSlow(portResults)
+}
 
-	fmt.Printf("\n%s%d ports scanned in %v | %d in use, %d available%s\n",
-		cyan, len(portResults), time.Since(startTime).Round(time.Millisecond), inUse, len(portResults)-inUse, reset)
+// ephemeralInfo is the JSON form of what portcheck 0 reports.
+type ephemeralInfo struct {
+	Port     int    `json:"port"`
+	Low      int    `json:"ephemeral_low"`
+	High     int    `json:"ephemeral_high"`
+	Reserved string `json:"reserved,omitempty"`
 }
 
-func printResult(r PortResult, showPID bool) {
-	if r.InUse {
-		info := fmt.Sprintf("Port %s%d%s is %s%sin use%s", bold, r.Port, reset, red, bold, reset)
-		if showPID && r.PID > 0 {
-			info += fmt.Sprintf(" (PID: %s%d%s, Process: %s%s%s)", yellow, r.PID, reset, cyan, r.Process, reset)
-		} else if showPID {
-			info += fmt.Sprintf(" %s(process info unavailable - may need root)%s", yellow, reset)
-		}
-		fmt.Printf("%s●%s %s\n", red, reset, info)
-	} else {
-		fmt.Printf("%s○%s Port %s%d%s is %s%savailable%s\n", green, reset, bold, r.Port, reset, green, bold, reset)
+// printEphemeralRange reports the range the kernel allocates ephemeral
+// ports from, which is what binding port 0 would draw on.
+func printEphemeralRange() {
+	lo, hi, ok := ephemeralRange()
+	if !ok {
+		fmt.Fprintln(os.Stderr, red+"Error: Port 0 is not a real port, and the ephemeral range could not be read from /proc/sys/net/ipv4/ip_local_port_range"+reset)
+		os.Exit(1)
+	}
+	reserved := reservedWithin(ephemeralReserved(), lo, hi)
+	if opts.json || opts.yaml {
+		writeJSON(ephemeralInfo{Low: lo, High: hi, Reserved: reserved})
+		return
+	}
+	fmt.Printf("Port %s0%s is not checked: binding it lets the kernel pick a free port from the ephemeral range %s%d-%d%s\n", bold, reset, bold, lo, hi, reset)
+	if reserved != "" {
+		fmt.Printf("%sReserved within it (never picked): %s%s\n", cyan, reserved, reset)
+	}
+}
+
+// canStream reports whether results can be printed as they arrive. Output
+// formats that need the whole sorted set, and modes that post-process it
+// (process and state lookups, passes) or check out of order (--randomize,
+// unless --no-sort asks for arrival order anyway), need the buffered path.
+func canStream(showPID bool) bool {
+	return !machineReadable() && !showPID && !opts.countByState && !opts.blocks && opts.passes <= 1 && (!opts.randomize || opts.noSort)
+}
+
+// fdHeadroom is how many file descriptors to leave free beyond the
+// concurrent checks: stdio, /proc reads and the odd log file.
+const fdHeadroom = 32
+
+// limitConcurrency keeps --concurrency below the open-file limit. Each
+// check holds a socket, and running out of descriptors makes binds fail
+// with EMFILE, which would be reported as ports in use. A default
+// concurrency is capped with a note; one given explicitly is kept, with a
+// warning.
+func limitConcurrency(explicit bool) {
+	var rl syscall.Rlimit
+	// RLIM_INFINITY is all ones as a uint64.
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil || rl.Cur == ^uint64(0) {
+		return
+	}
+	limit := max(int(min(rl.Cur, 1<<20))-fdHeadroom, 1)
+	if opts.concurrency <= limit {
+		return
 	}
+	if explicit {
+		warn("--concurrency %d leaves too little room under the open-file limit of %d; checks may fail with \"too many open files\"", opts.concurrency, rl.Cur)
+		return
+	}
+	if !opts.noWarnings {
+		fmt.Fprintf(os.Stderr, "%sNote: running %d checks at a time instead of %d to stay under the open-file limit of %d%s\n",
+			yellow, limit, opts.concurrency, rl.Cur, reset)
+	}
+	opts.concurrency = limit
 }
 
-func findProcessByPort(port int) (int, string) {
-	for _, f := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
-		if pid, name := searchNetFile(f, port); pid > 0 {
-			return pid, name
+// unprivilegedPortStart returns the lowest port a non-root user may bind.
+// Linux makes the privileged range configurable; 1024 is the default.
+func unprivilegedPortStart() int {
+	if data, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			return n
 		}
 	}
-	return 0, ""
+	return 1024
 }
 
-func searchNetFile(path string, port int) (int, string) {
-	file, err := os.Open(path)
-	if err != nil {
-		return 0, ""
+// warnPrivileged warns on stderr when a bind-based check includes ports
+// that a non-root user isn't allowed to bind, since every one of them would
+// fail with a permission error and look "in use".
+func warnPrivileged(lowest int) {
+	if opts.host != "" || opts.cidr != "" || opts.targetsJSON != "" || os.Geteuid() == 0 {
+		return
 	}
-	defer file.Close()
+	unprivileged := unprivilegedPortStart()
+	if lowest >= unprivileged {
+		return
+	}
+	warn("ports below %d can only be bound by root, so without sudo they will show as in use.\n"+
+		"Run with sudo, or use --host 127.0.0.1 to check them by connecting instead.", unprivileged)
+}
 
-	portHex := fmt.Sprintf("%04X", port)
-	scanner := bufio.NewScanner(file)
-	scanner.Scan() // Skip header
+// samplePorts returns k distinct ports picked at random from ports, in
+// ascending order. The choice is reproducible when --seed is given.
+func samplePorts(ports []int, k int) []int {
+	rng := seededRand()
+	sample := slices.Clone(ports)
+	rng.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+	sample = sample[:k]
+	slices.Sort(sample)
+	return sample
+}
 
-	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
-		if len(fields) < 10 {
-			continue
+// seededRand returns the random source of --sample and --randomize, seeded
+// with --seed when given so that runs can be repeated.
+func seededRand() *rand.Rand {
+	if opts.seed != nil {
+		return rand.New(rand.NewPCG(*opts.seed, *opts.seed))
+	}
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// scanInPasses splits the ports into opts.passes contiguous chunks and scans
+// one chunk per pass, waiting opts.passInterval in between to spread the
+// load of large ranges. The chunks are in port order, so the merged results
+// stay sorted.
+func scanInPasses(ctx context.Context, ports []int, showPID bool) []PortResult {
+	if opts.passes <= 1 {
+		return scanPorts(ctx, ports, showPID)
+	}
+
+	var portResults []PortResult
+	size := (len(ports) + opts.passes - 1) / opts.passes
+	for pass := 0; pass*size < len(ports); pass++ {
+		if pass > 0 {
+			select {
+			case <-time.After(opts.passInterval):
+			case <-ctx.Done():
+				return portResults
+			}
 		}
-		parts := strings.Split(fields[1], ":")
-		if len(parts) == 2 && parts[1] == portHex && fields[3] == "0A" {
-			return findPIDByInode(fields[9])
+		if opts.limitOpen > 0 && openSeen.Load() >= opts.limitOpen {
+			break
 		}
+		chunk := ports[pass*size : min((pass+1)*size, len(ports))]
+		if opts.verbose && !machineReadable() {
+			fmt.Printf("%sPass %d/%d: ports %d-%d%s\n", cyan, pass+1, opts.passes, chunk[0], chunk[len(chunk)-1], reset)
+		}
+		portResults = append(portResults, scanPorts(ctx, chunk, showPID)...)
 	}
-	return 0, ""
+	return portResults
 }
 
-func findPIDByInode(inode string) (int, string) {
-	procDir, err := os.Open("/proc")
-	if err != nil {
-		return 0, ""
+// scanPorts checks every port concurrently and returns the results sorted
+// by port. Ports not checked before ctx is done are left out.
+func scanPorts(ctx context.Context, ports []int, showPID bool) []PortResult {
+	var portResults []PortResult
+	streamPorts(ctx, ports, func(r PortResult) {
+		portResults = append(portResults, r)
+	})
+
+	if !opts.noSort {
+		slices.SortFunc(portResults, func(a, b PortResult) int { return a.Port - b.Port })
 	}
-	defer procDir.Close()
 
-	entries, _ := procDir.Readdirnames(-1)
-	socketLink := "socket:[" + inode + "]"
+	if showPID || opts.countByState {
+		// Process lookups are batched here rather than done per port.
+		resolveProcesses(portResults)
+	}
+	return portResults
+}
 
-	for _, entry := range entries {
-		pid, err := strconv.Atoi(entry)
-		if err != nil {
-			continue
+// streamPorts checks the ports with a fixed pool of workers and passes each
+// result to emit, on the calling goroutine, as soon as it is ready. The pool
+// bounds how many results are outstanding at once, so nothing is buffered.
+func streamPorts(ctx context.Context, ports []int, emit func(PortResult)) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make(chan PortResult)
+	var wg sync.WaitGroup
+
+	workers := min(opts.concurrency, len(ports))
+	// A gate adjusts how many of the workers may check at once.
+	var gate interface {
+		acquire()
+		release(failed bool)
+	}
+	if opts.ramp > 0 && opts.host != "" {
+		gate = newRamp(ctx, workers, opts.ramp)
+	} else if opts.throttleErrors && opts.host != "" {
+		gate = newThrottle(workers)
+	}
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				if gate != nil {
+					gate.acquire()
+				}
+				r, ok := checkScanned(ctx, cancel, p)
+				if gate != nil {
+					gate.release(r.Err != "")
+				}
+				if ok {
+					results <- r
+				}
+			}
+		}()
+	}
+
+	if opts.randomize {
+		// Only the order of the checks changes; scanPorts sorts the results.
+		ports = slices.Clone(ports)
+		rng := seededRand()
+		rng.Shuffle(len(ports), func(i, j int) { ports[i], ports[j] = ports[j], ports[i] })
+	}
+	go func() {
+		defer close(jobs)
+		for _, port := range ports {
+			select {
+			case jobs <- port:
+			case <-ctx.Done():
+				return
+			}
 		}
-		fdPath := filepath.Join("/proc", entry, "fd")
-		fds, err := os.ReadDir(fdPath)
-		if err != nil {
-			continue
+	}()
+
+	go func() { wg.Wait(); close(results) }()
+
+	for r := range results {
+		emit(r)
+	}
+}
+
+// checkScanned checks one port of a scan with the scan-wide options
+// applied: --jitter before the check, and the deadline and --limit-open
+// after it. ok is false when the result should be dropped.
+func checkScanned(ctx context.Context, cancel context.CancelFunc, port int) (PortResult, bool) {
+	if opts.jitter > 0 {
+		time.Sleep(rand.N(opts.jitter))
+	}
+	if ctx.Err() != nil {
+		return PortResult{}, false
+	}
+	r := checkPort(ctx, port, false)
+	if !r.InUse && ctx.Err() != nil {
+		return r, false // cut short by the deadline, not a real result
+	}
+	if r.InUse && opts.limitOpen > 0 {
+		// Keep exactly the first n in-use ports and stop the rest.
+		n := openSeen.Add(1)
+		if n > opts.limitOpen {
+			return r, false
+		}
+		if n == opts.limitOpen {
+			cancel()
+		}
+	}
+	return r, true
+}
+
+func printResult(r PortResult, showPID bool) {
+	// Remote results name their host, as a scan may cover several.
+	port := strconv.Itoa(r.Port)
+	if r.Host != "" {
+		port = net.JoinHostPort(r.Host, port)
+	}
+	// In-use ports are always named; --resolve names the rest too.
+	service := ""
+	if r.InUse || opts.resolve {
+		if name := serviceName(r.Protocol, r.Port); name != "" {
+			service = " (" + name + ")"
 		}
-		for _, fd := range fds {
-			if link, err := os.Readlink(filepath.Join(fdPath, fd.Name())); err == nil && link == socketLink {
-				comm, _ := os.ReadFile(filepath.Join("/proc", entry, "comm"))
-				return pid, strings.TrimSpace(string(comm))
+	}
+	if r.Unstable {
+		fmt.Printf("%s%s%s Port %s%s%s%s is %s%sunstable%s (changed between checks)\n", yellow, symbolUnstable, reset, bold, port, reset, service, yellow, bold, reset)
+		return
+	}
+	if r.InUse {
+		if r.Host != "" {
+			speaks := ""
+			if r.DetectedProto != "" {
+				speaks = fmt.Sprintf(" (speaks %s%s%s)", cyan, r.DetectedProto, reset)
+			}
+			speaks += formatReachability(r) + formatFallback(r)
+			if r.Tier == tierSlow {
+				fmt.Printf("%s%s%s Port %s%s%s%s is %s%sopen but slow%s%s%s\n", yellow, symbolOpen, reset, bold, port, reset, service, yellow, bold, reset, slowNote(r), speaks)
+				return
 			}
+			fmt.Printf("%s%s%s Port %s%s%s%s is %s%sopen%s%s\n", red, symbolOpen, reset, bold, port, reset, service, red, bold, reset, speaks)
+			return
+		}
+		info := fmt.Sprintf("Port %s%d%s%s is %s%sin use%s", bold, r.Port, reset, service, red, bold, reset)
+		marker := red
+		if r.Tier == tierSlow {
+			info = fmt.Sprintf("Port %s%d%s%s is %s%sin use but slow%s%s", bold, r.Port, reset, service, yellow, bold, reset, slowNote(r))
+			marker = yellow
 		}
+		if r.Wildcard != "" {
+			info += fmt.Sprintf(" via wildcard (%s)", r.Wildcard)
+		}
+		// Ports held by the current user's own processes get a green
+		// "yours" so they stand out from other users' and system services.
+		mine := ""
+		if r.OwnedByMe {
+			mine = fmt.Sprintf(", %syours%s", green, reset)
+		}
+		if showPID && r.PID > 0 && r.Cmdline != "" {
+			prefix := fmt.Sprintf("%s %s (PID: %s%d%s, Command: ", symbolOpen, info, yellow, r.PID, reset)
+			cmdline := r.Cmdline
+			if width := lineWidth(); width > 0 {
+				// Long command lines are cut to fit, leaving the rest intact.
+				cmdline = truncate(cmdline, max(width-visibleLen(prefix+mine+")"), 10))
+			}
+			info += fmt.Sprintf(" (PID: %s%d%s, Command: %s%s%s%s)", yellow, r.PID, reset, cyan, cmdline, reset, mine)
+		} else if showPID && r.PID > 0 {
+			info += fmt.Sprintf(" (PID: %s%d%s, Process: %s%s%s%s)", yellow, r.PID, reset, cyan, r.Process, reset, mine)
+		} else if showPID && r.PIDLookupStopped {
+			info += fmt.Sprintf(" %s(process info unavailable: lookup stopped early)%s", yellow, reset)
+		} else if showPID {
+			info += fmt.Sprintf(" %s(process info unavailable - may need root)%s", yellow, reset)
+		}
+		fmt.Printf("%s%s%s %s\n", marker, symbolOpen, reset, info)
+		if showPID && opts.tree && r.PID > 0 {
+			printTree(r.PID)
+		}
+	} else if r.State == stateOpenFiltered {
+		fmt.Printf("%s%s%s Port %s%s%s/udp%s is %s%sopen|filtered%s (no reply to %s probe)\n", yellow, symbolUnknown, reset, bold, port, reset, service, yellow, bold, reset, r.Probe)
+	} else if r.State == stateFiltered {
+		fmt.Printf("%s%s%s Port %s%d%s%s is %s%sfiltered%s (%s)\n", yellow, symbolUnknown, reset, bold, r.Port, reset, service, yellow, bold, reset, r.Err)
+	} else if r.Host != "" {
+		fmt.Printf("%s%s%s Port %s%s%s%s is %s%sclosed%s%s\n", green, symbolClosed, reset, bold, port, reset, service, green, bold, reset, formatReachability(r))
+	} else {
+		fmt.Printf("%s%s%s Port %s%d%s%s is %s%savailable%s\n", green, symbolClosed, reset, bold, r.Port, reset, service, green, bold, reset)
+	}
+}
+
+func detectIPv6() bool {
+	if _, err := os.Stat("/proc/net/tcp6"); err == nil {
+		return true
+	}
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		return false
 	}
-	return 0, ""
+	listener.Close()
+	return true
 }
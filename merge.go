@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// printMerged prints results sorted by host and port, collapsing the
+// results for the same host and port into one line that lists the status
+// of each protocol, for --merge-protocols.
+func printMerged(results []PortResult) {
+	for i := 0; i < len(results); {
+		j := i + 1
+		for j < len(results) && results[j].Host == results[i].Host && results[j].Port == results[i].Port {
+			j++
+		}
+		if j-i == 1 {
+			printResult(results[i], false)
+		} else {
+			printProtocols(results[i:j])
+		}
+		i = j
+	}
+}
+
+// printProtocols prints one line for several results of the same port,
+// such as "● Port 53 (domain): tcp open, udp open|filtered". The marker
+// is that of the busiest protocol.
+func printProtocols(results []PortResult) {
+	r := results[0]
+	port := strconv.Itoa(r.Port)
+	if r.Host != "" {
+		port = net.JoinHostPort(r.Host, port)
+	}
+	marker, markerColor := symbolClosed, green
+	inUse := false
+	var statuses []string
+	for _, r := range results {
+		status := resultStatus(r)
+		color := yellow
+		switch {
+		case r.InUse:
+			color = red
+			marker, markerColor, inUse = symbolOpen, red, true
+		case status == "available" || status == "closed":
+			color = green
+		case !inUse:
+			marker, markerColor = symbolUnknown, yellow
+		}
+		statuses = append(statuses, fmt.Sprintf("%s %s%s%s", r.Protocol, color, status, reset))
+	}
+	service := ""
+	if inUse || opts.resolve {
+		if name := serviceName(r.Protocol, r.Port); name != "" {
+			service = " (" + name + ")"
+		}
+	}
+	fmt.Printf("%s%s%s Port %s%s%s%s: %s\n", markerColor, marker, reset, bold, port, reset, service, strings.Join(statuses, ", "))
+}
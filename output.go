@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// scanSummary is the machine-readable counterpart of the summary line
+// printed after a range scan.
+type scanSummary struct {
+	Scanned   int   `json:"scanned"`
+	InUse     int   `json:"in_use"`
+	Available int   `json:"available"`
+	AnyInUse  bool  `json:"any_in_use"`
+	ElapsedMS int64 `json:"elapsed_ms"`
+
+	States      map[string]int `json:"states,omitempty"`
+	Families    map[string]int `json:"families,omitempty"`
+	Violations  []int          `json:"policy_violations,omitempty"`
+	Unstable    int            `json:"unstable,omitempty"`
+	Slow        int            `json:"slow,omitempty"`
+	Processes   int            `json:"processes,omitempty"`
+	Fingerprint string         `json:"fingerprint,omitempty"`
+	Interrupted bool           `json:"interrupted,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+	Header      *scanHeader    `json:"header,omitempty"`
+}
+
+// scanHeader records when and how a scan was run so saved output is
+// self-documenting.
+type scanHeader struct {
+	Timestamp string   `json:"timestamp"`
+	Targets   string   `json:"targets"`
+	Flags     []string `json:"flags"`
+}
+
+// header is set when --header is given.
+var header *scanHeader
+
+// newHeader builds the header for the given targets, which are the ports
+// actually checked after resolving ephemeral and clamping to --min-port
+// and --max-port. The flags are the command-line arguments other than the
+// target argument as given.
+func newHeader(targets, targetArg string) *scanHeader {
+	h := &scanHeader{Timestamp: time.Now().Format(time.RFC3339), Targets: targets, Flags: []string{}}
+	for _, arg := range os.Args[1:] {
+		if arg != targetArg {
+			h.Flags = append(h.Flags, arg)
+		}
+	}
+	return h
+}
+
+// String formats the header as a comment line for text output.
+func (h *scanHeader) String() string {
+	return fmt.Sprintf("# portcheck %s targets=%s flags=%s", h.Timestamp, h.Targets, strings.Join(h.Flags, " "))
+}
+
+type jsonReport struct {
+	Results []PortResult `json:"results"`
+	Summary scanSummary  `json:"summary"`
+}
+
+func summarize(results []PortResult, elapsed time.Duration) scanSummary {
+	summary := scanSummary{Scanned: len(results), ElapsedMS: elapsed.Milliseconds()}
+	for _, r := range results {
+		if r.InUse {
+			summary.InUse++
+		}
+	}
+	summary.Available = summary.Scanned - summary.InUse
+	summary.AnyInUse = summary.InUse > 0
+	summary.Header = header
+	if opts.countByState {
+		summary.States = countStates(results)
+	}
+	if families := countFamilies(results); len(families) > 0 {
+		summary.Families = families
+	}
+	summary.Violations = policyViolations(results)
+	summary.Unstable = countUnstable(results)
+	summary.Slow = countSlow(results)
+	if opts.countProcs {
+		summary.Processes = len(owningPIDs(results))
+	}
+	summary.Interrupted = interrupted.Load()
+	summary.Warnings = collectWarnings(results)
+	if opts.fingerprint {
+		summary.Fingerprint = fingerprint(results)
+	}
+	return summary
+}
+
+// countStates tallies the socket states of the in-use results. Ports whose
+// socket couldn't be found in /proc are counted as UNKNOWN.
+func countStates(results []PortResult) map[string]int {
+	states := make(map[string]int)
+	for _, r := range results {
+		if !r.InUse {
+			continue
+		}
+		state := r.State
+		if state == "" {
+			state = "UNKNOWN"
+		}
+		states[state]++
+	}
+	return states
+}
+
+// formatStates renders a state tally as "LISTEN 3, ESTABLISHED 1", most
+// common first.
+func formatStates(states map[string]int) string {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if states[names[i]] != states[names[j]] {
+			return states[names[i]] > states[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, states[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// countUnstable counts the results whose --stability checks disagreed.
+func countUnstable(results []PortResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Unstable {
+			n++
+		}
+	}
+	return n
+}
+
+// owningPIDs returns the distinct PIDs that own the in-use results, for
+// --count-processes. Ports whose owner wasn't found don't contribute.
+func owningPIDs(results []PortResult) map[int]bool {
+	pids := make(map[int]bool)
+	for _, r := range results {
+		if r.InUse && r.PID > 0 {
+			pids[r.PID] = true
+		}
+	}
+	return pids
+}
+
+// printProcessCount prints, with --count-processes, how many processes
+// the in-use ports belong to, e.g. "7 ports in use across 4 processes".
+func printProcessCount(results []PortResult) {
+	if !opts.countProcs {
+		return
+	}
+	inUse, unknown := 0, 0
+	for _, r := range results {
+		if r.InUse {
+			inUse++
+			if r.PID <= 0 {
+				unknown++
+			}
+		}
+	}
+	if inUse == 0 {
+		return
+	}
+	procs := len(owningPIDs(results))
+	line := fmt.Sprintf("%s %s in use across %s %s", formatCount(inUse), plural(inUse, "port", "ports"),
+		formatCount(procs), plural(procs, "process", "processes"))
+	if unknown > 0 {
+		line += fmt.Sprintf(" (%s with an unknown owner)", formatCount(unknown))
+	}
+	fmt.Printf("%s%s%s\n", cyan, line, reset)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// countFamilies tallies the address families of the in-use results whose
+// socket was found in /proc. It is empty when no family is known.
+func countFamilies(results []PortResult) map[string]int {
+	families := make(map[string]int)
+	for _, r := range results {
+		if r.InUse && r.Family != "" {
+			families[r.Family]++
+		}
+	}
+	return families
+}
+
+// formatFamilies renders a family tally as "2 ipv4, 1 ipv6".
+func formatFamilies(families map[string]int) string {
+	var parts []string
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if n := families[family]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, family))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// redirectOutput sends everything portcheck prints on stdout to a file,
+// replacing it or, with --append, adding to the end. Appends are single
+// O_APPEND writes per report, so concurrent runs logging to the same file
+// don't interleave within a JSON line.
+func redirectOutput(path string, appendMode bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	os.Stdout = f
+	return nil
+}
+
+// redirectFD sends everything printed to stdout to an already open file
+// descriptor, for --output-fd, so a parent process can read results from a
+// pipe of its own while stdout and stderr stay free for logs.
+func redirectFD(fd int) error {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return fmt.Errorf("--output-fd %d: not an open file descriptor", fd)
+	}
+	if mode := flags & syscall.O_ACCMODE; mode != syscall.O_WRONLY && mode != syscall.O_RDWR {
+		return fmt.Errorf("--output-fd %d: file descriptor is not open for writing", fd)
+	}
+	os.Stdout = os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	return nil
+}
+
+// machineReadable reports whether a machine-readable output format was
+// selected, in which case the human-oriented progress lines are skipped.
+func machineReadable() bool {
+	return opts.json || opts.grepable || opts.yaml || opts.csv
+}
+
+// exitReport prints the results in the selected machine-readable format and
+// exits: with status 1 if any port is in use, or with an --allow/--deny
+// policy only if it is violated, so the body and the exit code always agree.
+func exitReport(results []PortResult, elapsed time.Duration) {
+	summary := writeReport(results, elapsed)
+	exitIfAborted()
+	exitIfInterrupted()
+	if policySet() && len(summary.Violations) > 0 || !policySet() && summary.AnyInUse && !opts.grepable && !opts.csv {
+		os.Exit(1)
+	}
+	exitIfSlow(results)
+	os.Exit(0)
+}
+
+// writeReport prints the results in the selected machine-readable format
+// and returns their summary, for modes such as --wait-count that decide the
+// exit status themselves.
+func writeReport(results []PortResult, elapsed time.Duration) scanSummary {
+	labelServices(results)
+	if results == nil {
+		results = []PortResult{}
+	}
+	summary := summarize(results, elapsed)
+	switch {
+	case opts.csv:
+		writeCSV(results)
+	case opts.grepable:
+		writeGrepable(results)
+	default:
+		writeJSON(jsonReport{Results: results, Summary: summary})
+	}
+	return summary
+}
+
+// writeGrepable prints one nmap-style grepable line per host, e.g.
+//
+//	Host: 127.0.0.1 ()	Ports: 22/open/tcp/sshd////, 80/open/tcp/nginx////
+//
+// Only in-use (open) ports are listed, as nmap does; the rest are counted
+// in an "Ignored State" field.
+func writeGrepable(results []PortResult) {
+	if header != nil {
+		fmt.Println(header)
+	}
+
+	var hosts []string
+	byHost := make(map[string][]PortResult)
+	for _, r := range results {
+		if _, ok := byHost[r.Host]; !ok {
+			hosts = append(hosts, r.Host)
+		}
+		byHost[r.Host] = append(byHost[r.Host], r)
+	}
+
+	for _, host := range hosts {
+		var ports []string
+		ignored := 0
+		for _, r := range byHost[host] {
+			if !r.InUse {
+				ignored++
+				continue
+			}
+			// port/state/protocol/owner/service/rpc/version/
+			owner := strings.ReplaceAll(r.Process, "/", "|")
+			ports = append(ports, fmt.Sprintf("%d/open/%s/%s/%s///", r.Port, r.Protocol, owner, r.Service))
+		}
+
+		name := host
+		if name == "" {
+			name = "127.0.0.1 (localhost)"
+		} else {
+			name += " ()"
+		}
+		line := fmt.Sprintf("Host: %s\tPorts: %s", name, strings.Join(ports, ", "))
+		if ignored > 0 {
+			line += fmt.Sprintf("\tIgnored State: closed (%d)", ignored)
+		}
+		fmt.Println(line)
+	}
+}
+
+// csvColumns are the CSV columns unless --columns picks others.
+const csvColumns = "host,port,protocol,in_use,state,pid,process,service,error"
+
+// writeCSV prints one row per result, after a header row unless
+// --no-header is given (for appending to an existing file). With --header
+// the scan header comes first as a "#" comment line, but never when
+// appending or with --no-header, where it would land between data rows.
+// Local results have an empty host.
+func writeCSV(results []PortResult) {
+	cols := opts.columns
+	if cols == nil {
+		cols, _ = parseColumns(csvColumns)
+	}
+	if header != nil && !opts.appendOutput && !opts.noHeader {
+		fmt.Println(header)
+	}
+	w := csv.NewWriter(os.Stdout)
+	if !opts.noHeader {
+		w.Write(columnNames(cols))
+	}
+	for _, r := range results {
+		w.Write(columnValues(cols, r))
+	}
+	w.Flush()
+}
+
+// writeJSON prints a report, or any other value, as JSON or, with --yaml,
+// YAML, exiting with status 2 if it can't be written.
+func writeJSON(v any) {
+	var err error
+	if opts.yaml {
+		err = writeYAML(os.Stdout, v)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		if !opts.appendOutput {
+			enc.SetIndent("", "  ")
+		}
+		err = enc.Encode(v)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(2)
+	}
+}
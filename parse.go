@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when parsing port arguments. They are wrapped in a
+// *ParseError carrying the offending input, so callers can tell them apart
+// with errors.Is and recover the input with errors.As.
+var (
+	ErrInvalidPort        = errors.New("invalid port number")
+	ErrInvalidRange       = errors.New("invalid port range")
+	ErrInvalidRangeFormat = errors.New("invalid port range format")
+)
+
+// ParseError records a port or range argument that could not be parsed.
+type ParseError struct {
+	Input string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Err, e.Input)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parsePort parses a single port in 1-65535.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, &ParseError{Input: s, Err: ErrInvalidPort}
+	}
+	return port, nil
+}
+
+// parseRange parses "<start>-<end>" or "<start>+<count>" into an inclusive
+// range of ports.
+func parseRange(s string) (start, end int, err error) {
+	sep := "-"
+	if strings.Contains(s, "+") {
+		sep = "+"
+	}
+	parts := strings.Split(s, sep)
+	if len(parts) != 2 {
+		return 0, 0, &ParseError{Input: s, Err: ErrInvalidRangeFormat}
+	}
+
+	start, err1 := strconv.Atoi(parts[0])
+	end, err2 := strconv.Atoi(parts[1])
+	if sep == "+" {
+		if end < 0 {
+			err2 = ErrInvalidRange
+		}
+		end += start
+	}
+	if err1 != nil || err2 != nil || start > end || start < 1 || end > 65535 {
+		return 0, 0, &ParseError{Input: s, Err: ErrInvalidRange}
+	}
+	return start, end, nil
+}
+
+// parseErrorMessage formats a parse error for the CLI.
+func parseErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidRangeFormat):
+		return "Invalid port range format"
+	case errors.Is(err, ErrInvalidRange):
+		return "Invalid port range"
+	default:
+		return "Invalid port number"
+	}
+}
+
+// parsePortList parses a comma-separated list of ports and ranges such as
+// "22,80,8000-8100" into ports in the order given. Overlapping entries are
+// kept; see dedupePorts.
+func parsePortList(s string) ([]int, error) {
+	var ports []int
+	for _, item := range strings.Split(s, ",") {
+		if strings.ContainsAny(item, "-+") {
+			start, end, err := parseRange(item)
+			if err != nil {
+				return nil, err
+			}
+			for port := start; port <= end; port++ {
+				ports = append(ports, port)
+			}
+			continue
+		}
+		port, err := parsePort(item)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// dedupePorts drops repeated ports, keeping the first occurrence of each.
+func dedupePorts(ports []int) []int {
+	seen := make(map[int]struct{}, len(ports))
+	unique := ports[:0:0]
+	for _, port := range ports {
+		if _, ok := seen[port]; !ok {
+			seen[port] = struct{}{}
+			unique = append(unique, port)
+		}
+	}
+	return unique
+}
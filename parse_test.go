@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr error
+	}{
+		{"80", 80, nil},
+		{"1", 1, nil},
+		{"65535", 65535, nil},
+		{"0", 0, ErrInvalidPort},
+		{"65536", 0, ErrInvalidPort},
+		{"70000", 0, ErrInvalidPort},
+		{"-1", 0, ErrInvalidPort},
+		{"http", 0, ErrInvalidPort},
+		{"", 0, ErrInvalidPort},
+	}
+	for _, tt := range tests {
+		got, err := parsePort(tt.input)
+		checkParseError(t, "parsePort", tt.input, err, tt.wantErr)
+		if got != tt.want {
+			t.Errorf("parsePort(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input      string
+		start, end int
+		wantErr    error
+	}{
+		{"8000-8100", 8000, 8100, nil},
+		{"80-80", 80, 80, nil},
+		{"8000+100", 8000, 8100, nil},
+		{"65535+0", 65535, 65535, nil},
+		{"1-2-3", 0, 0, ErrInvalidRangeFormat},
+		{"8000", 0, 0, ErrInvalidRangeFormat},
+		{"1+2+3", 0, 0, ErrInvalidRangeFormat},
+		{"a-100", 0, 0, ErrInvalidRange},
+		{"100-", 0, 0, ErrInvalidRange},
+		{"0-100", 0, 0, ErrInvalidRange},
+		{"1-65536", 0, 0, ErrInvalidRange},
+		{"100-10", 0, 0, ErrInvalidRange},
+		{"65000+1000", 0, 0, ErrInvalidRange},
+		{"1+65535", 0, 0, ErrInvalidRange},
+		{"80+-1", 0, 0, ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		start, end, err := parseRange(tt.input)
+		checkParseError(t, "parseRange", tt.input, err, tt.wantErr)
+		if start != tt.start || end != tt.end {
+			t.Errorf("parseRange(%q) = %d, %d, want %d, %d", tt.input, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+// checkParseError checks that err is nil when want is, and otherwise a
+// *ParseError for input that matches want with errors.Is.
+func checkParseError(t *testing.T, fn, input string, err, want error) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Errorf("%s(%q) returned error %v", fn, input, err)
+		}
+		return
+	}
+	if !errors.Is(err, want) {
+		t.Errorf("%s(%q) error = %v, want %v", fn, input, err, want)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Errorf("%s(%q) error %v is not a *ParseError", fn, input, err)
+	} else if perr.Input != input {
+		t.Errorf("%s(%q) ParseError.Input = %q", fn, input, perr.Input)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// policySet reports whether an --allow or --deny policy was given.
+func policySet() bool {
+	return opts.allow != nil || opts.deny != nil
+}
+
+// violates reports why an in-use port breaks the policy, or "" if it
+// doesn't.
+func violates(port int) string {
+	if opts.allow != nil && !slices.Contains(opts.allow, port) {
+		return "is not in --allow"
+	}
+	if slices.Contains(opts.deny, port) {
+		return "is in --deny"
+	}
+	return ""
+}
+
+// policyViolations returns the in-use ports that break the policy, once
+// each and in order.
+func policyViolations(results []PortResult) []int {
+	var ports []int
+	for _, r := range results {
+		if r.InUse && violates(r.Port) != "" {
+			ports = append(ports, r.Port)
+		}
+	}
+	slices.Sort(ports)
+	return slices.Compact(ports)
+}
+
+// enforcePolicy prints each port that breaks the --allow/--deny policy and
+// exits 1 if there were any. It does nothing without a policy.
+func enforcePolicy(results []PortResult) {
+	if !policySet() {
+		return
+	}
+	violations := policyViolations(results)
+	if len(violations) == 0 {
+		fmt.Printf("%sPolicy check passed%s\n", green, reset)
+		return
+	}
+	fmt.Printf("\n%s%sPolicy violations:%s\n", bold, red, reset)
+	for _, port := range violations {
+		fmt.Printf("%s%s%s Port %s%d%s is in use and %s\n", red, symbolFail, reset, bold, port, reset, violates(port))
+	}
+	os.Exit(1)
+}
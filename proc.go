@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// procSocket is one decoded line of /proc/net/{tcp,tcp6,udp,udp6}.
+type procSocket struct {
+	Addr   netip.Addr // local address; invalid if it couldn't be decoded
+	Port   int
+	State  string
+	Inode  string
+	Family string         // "ipv4" or "ipv6", from the table it was read from
+	Remote netip.AddrPort // remote address and port; unspecified for listeners
+	UID    string         // uid of the socket's creator, in decimal
+	// RxQueue is the rx_queue column. For a TCP listener it is the number
+	// of connections waiting in the accept queue.
+	RxQueue int
+	// TimerState is the kernel timer pending on the socket, from the
+	// tr:tm->when column: "off", "retransmit", "keepalive", "time_wait" or
+	// "zero_window_probe". TimerLeft is how long until it fires.
+	TimerState string
+	TimerLeft  time.Duration
+}
+
+// timerStates maps the tr codes of /proc/net/tcp to names.
+var timerStates = map[string]string{
+	"00": "off", "01": "retransmit", "02": "keepalive", "03": "time_wait", "04": "zero_window_probe",
+}
+
+// parseTimer decodes a tr:tm->when column such as "02:000A3E1F". The
+// remaining time is in clock ticks.
+func parseTimer(s string) (string, time.Duration) {
+	tr, when, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0
+	}
+	state, ok := timerStates[tr]
+	if !ok {
+		state = "unknown"
+	}
+	ticks, _ := strconv.ParseUint(when, 16, 32)
+	return state, time.Duration(ticks) * time.Second / clockTicks
+}
+
+// tcpListen is the kernel's hex code for the LISTEN state.
+const tcpListen = "0A"
+
+// tcpEstablished is the kernel's hex code for the ESTABLISHED state.
+const tcpEstablished = "01"
+
+// sockKey identifies a bound socket by protocol and local port.
+type sockKey struct {
+	proto string
+	port  int
+}
+
+// procOwner is the process holding a socket inode.
+type procOwner struct {
+	PID  int
+	Name string
+}
+
+// procNetFiles returns the /proc/net tables to read for a protocol,
+// skipping the IPv6 table when the host has no IPv6 stack.
+func procNetFiles(proto string) []string {
+	files := []string{"/proc/net/" + proto}
+	if hasIPv6 {
+		files = append(files, "/proc/net/"+proto+"6")
+	}
+	return files
+}
+
+// isBound reports whether a socket in the given state holds its local port.
+// TCP ports are held by listeners; any UDP socket holds its port.
+func isBound(proto, state string) bool {
+	return proto == "udp" || state == tcpListen
+}
+
+// parseProcAddr decodes a hex local address from /proc/net. The kernel
+// prints the address as 32-bit words in host byte order, so on
+// little-endian machines each word's bytes come out reversed:
+// 127.0.0.1 is "0100007F", and ::1 is "00000000000000000000000001000000".
+// It returns the zero Addr if s is malformed.
+func parseProcAddr(s string) netip.Addr {
+	if len(s) != 8 && len(s) != 32 {
+		return netip.Addr{}
+	}
+	b := make([]byte, len(s)/2)
+	for i := 0; i < len(s); i += 8 {
+		word, err := strconv.ParseUint(s[i:i+8], 16, 32)
+		if err != nil {
+			return netip.Addr{}
+		}
+		binary.NativeEndian.PutUint32(b[i/2:], uint32(word))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// parseProcAddrPort decodes a /proc/net "address:port" field such as
+// "0100007F:1F90" (127.0.0.1:8080). The port is plain big-endian hex.
+func parseProcAddrPort(s string) (netip.AddrPort, bool) {
+	addr, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(parseProcAddr(addr), uint16(p)), true
+}
+
+// isLoopback reports whether a socket is bound to a loopback address only,
+// including IPv4 loopback mapped into the IPv6 table.
+func (s procSocket) isLoopback() bool {
+	return s.Addr.Unmap().IsLoopback()
+}
+
+// procWarning makes sure the unreadable-/proc warning is printed only once
+// per run, however many lookups hit it.
+var procWarning sync.Once
+
+// warnProcUnreadable explains a permission failure reading a /proc/net table,
+// which would otherwise look like "no process found".
+func warnProcUnreadable(path string, err error) {
+	if !errors.Is(err, fs.ErrPermission) {
+		return
+	}
+	procWarning.Do(func() {
+		warn("cannot read %s (permission denied); process info will be unavailable.\n"+
+			"/proc may be mounted with hidepid, or the container may restrict /proc/net access.", path)
+	})
+}
+
+// readProcNet reads the sockets of a /proc/net table, or none if it can't
+// be read. Only owner lookups warn about that, through readOwnerTable;
+// elsewhere a missing table just means fewer details.
+func readProcNet(path string) []procSocket {
+	sockets, _ := loadProcNet(path)
+	return sockets
+}
+
+// readOwnerTable is readProcNet for the lookups behind --pid and status,
+// which warn once if the table is unreadable, since their owners would
+// otherwise silently come out as unknown.
+func readOwnerTable(path string) []procSocket {
+	sockets, err := loadProcNet(path)
+	if err != nil {
+		warnProcUnreadable(path, err)
+	}
+	return sockets
+}
+
+func loadProcNet(path string) ([]procSocket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	family := "ipv4"
+	if strings.HasSuffix(path, "6") {
+		family = "ipv6"
+	}
+
+	var sockets []procSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Skip header
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, ok := parseProcAddrPort(fields[1])
+		if !ok {
+			continue
+		}
+		var rxQueue uint64
+		if _, rx, ok := strings.Cut(fields[4], ":"); ok {
+			rxQueue, _ = strconv.ParseUint(rx, 16, 32)
+		}
+		remote, _ := parseProcAddrPort(fields[2])
+		timer, left := parseTimer(fields[5])
+		sockets = append(sockets, procSocket{
+			Addr: local.Addr(), Port: int(local.Port()), State: fields[3], Inode: fields[9],
+			Family: family, Remote: remote, UID: fields[7], RxQueue: int(rxQueue),
+			TimerState: timer, TimerLeft: left,
+		})
+	}
+	return sockets, scanner.Err()
+}
+
+// buildProcIndex reads every /proc/net table once and maps each
+// (protocol, port) to the socket holding it. A bound socket (a TCP listener
+// or any UDP socket) wins over others using the same local port.
+func buildProcIndex() map[sockKey]procSocket {
+	index := make(map[sockKey]procSocket)
+	for _, proto := range []string{"tcp", "udp"} {
+		for _, f := range procNetFiles(proto) {
+			for _, s := range readOwnerTable(f) {
+				key := sockKey{proto, s.Port}
+				if cur, ok := index[key]; !ok || isBound(proto, s.State) && !isBound(proto, cur.State) {
+					index[key] = s
+				}
+			}
+		}
+	}
+	return index
+}
+
+// resolveProcesses fills in the socket state and process details of the
+// in-use results using one pass over /proc/net and a single /proc fd walk,
+// instead of a full lookup per port.
+func resolveProcesses(results []PortResult) {
+	index := buildProcIndex()
+	wanted := make(map[string]bool)
+	for _, r := range results {
+		if s, ok := index[sockKey{r.Protocol, r.Port}]; ok && r.InUse {
+			wanted[s.Inode] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	owners, stopped := findPIDsByInodes(wanted, opts.pidMaxScan)
+	var backlogs map[string]int
+	for i := range results {
+		r := &results[i]
+		s, ok := index[sockKey{r.Protocol, r.Port}]
+		if !r.InUse || !ok {
+			continue
+		}
+		r.State, r.Family = stateName(r.Protocol, s.State), s.Family
+		if r.Protocol == "tcp" {
+			r.TimerState = s.TimerState
+		}
+		if r.Protocol == "tcp" && s.State == tcpListen {
+			if backlogs == nil {
+				backlogs = listenBacklogs()
+			}
+			r.QueueLen, r.QueueMax = s.RxQueue, backlogs[s.Inode]
+		}
+		if owner, ok := owners[s.Inode]; ok {
+			r.PID, r.Process = owner.PID, owner.Name
+			r.OwnedByMe = ownedByMe(r.PID)
+			if opts.fullCommand {
+				r.Cmdline = readCmdline(r.PID)
+			}
+		} else {
+			r.PIDLookupStopped = stopped
+		}
+	}
+}
+
+// tcpStates maps the kernel's hex TCP state codes to their names.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1",
+	"05": "FIN_WAIT2", "06": "TIME_WAIT", "07": "CLOSE", "08": "CLOSE_WAIT",
+	"09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+}
+
+// stateName returns the readable name of a /proc/net socket state. UDP only
+// distinguishes connected sockets from unconnected ones.
+func stateName(proto, state string) string {
+	if proto == "udp" {
+		if state == "01" {
+			return "ESTABLISHED"
+		}
+		return "UNCONN"
+	}
+	if name, ok := tcpStates[state]; ok {
+		return name
+	}
+	return state
+}
+
+// findWildcardListener returns the wildcard address ("0.0.0.0" or "::") of a
+// socket holding the port on all interfaces, or "" if there is none. Such a
+// listener makes binding any specific address on that port fail too.
+func findWildcardListener(proto string, port int) string {
+	for _, f := range procNetFiles(proto) {
+		for _, s := range readProcNet(f) {
+			if s.Port != port || !isBound(proto, s.State) || !s.Addr.IsUnspecified() {
+				continue
+			}
+			if s.Addr.Is6() {
+				return "::"
+			}
+			return "0.0.0.0"
+		}
+	}
+	return ""
+}
+
+// findProcessByPort fills in the socket state, address family and owner of
+// an in-use result, preferring a bound socket over others on the same local
+// port.
+func findProcessByPort(r *PortResult) {
+	var match *procSocket
+	for _, f := range procNetFiles(r.Protocol) {
+		for _, s := range readOwnerTable(f) {
+			if s.Port != r.Port {
+				continue
+			}
+			if isBound(r.Protocol, s.State) {
+				match = &s
+				break
+			}
+			if match == nil {
+				match = &s
+			}
+		}
+		if match != nil && isBound(r.Protocol, match.State) {
+			break
+		}
+	}
+	if match == nil {
+		return
+	}
+	r.State, r.Family = stateName(r.Protocol, match.State), match.Family
+	if r.Protocol == "tcp" {
+		r.TimerState = match.TimerState
+	}
+	r.PID, r.Process, r.PIDLookupStopped = findPIDByInode(match.Inode)
+	r.OwnedByMe = r.PID > 0 && ownedByMe(r.PID)
+}
+
+// findPIDByInode returns the owner of a socket inode, and whether the
+// lookup gave up before finding it.
+func findPIDByInode(inode string) (int, string, bool) {
+	owners, stopped := findPIDsByInodes(map[string]bool{inode: true}, 0)
+	owner := owners[inode]
+	return owner.PID, owner.Name, stopped && owner.PID == 0
+}
+
+// findPIDsByInodes walks /proc/*/fd once and returns the owner of each
+// wanted socket inode, stopping early once all have been found. Only the
+// wanted inodes are kept, so memory stays proportional to the ports asked
+// about however many sockets the host has. The walk gives up after
+// --pid-timeout, as hosts with huge numbers of open files can take seconds
+// to walk, or after maxScan processes if maxScan is positive; stopped then
+// reports that some owners may be missing.
+func findPIDsByInodes(inodes map[string]bool, maxScan int) (owners map[string]procOwner, stopped bool) {
+	owners = make(map[string]procOwner)
+	procDir, err := os.Open("/proc")
+	if err != nil {
+		return owners, false
+	}
+	defer procDir.Close()
+
+	entries, _ := procDir.Readdirnames(-1)
+
+	start := time.Now()
+	expired := func() bool { return opts.pidTimeout > 0 && time.Since(start) > opts.pidTimeout }
+	scanned := 0
+	for _, entry := range entries {
+		if expired() {
+			return owners, true
+		}
+		pid, err := strconv.Atoi(entry)
+		if err != nil {
+			continue
+		}
+		if scanned++; maxScan > 0 && scanned > maxScan {
+			return owners, true
+		}
+		fdPath := filepath.Join("/proc", entry, "fd")
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			// A single process can hold tens of thousands of descriptors.
+			if expired() {
+				return owners, true
+			}
+			link, err := os.Readlink(filepath.Join(fdPath, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, done := owners[inode]; !inodes[inode] || done {
+				continue
+			}
+			comm, _ := os.ReadFile(filepath.Join("/proc", entry, "comm"))
+			owners[inode] = procOwner{PID: pid, Name: strings.TrimSpace(string(comm))}
+			if len(owners) == len(inodes) {
+				return owners, false
+			}
+		}
+	}
+	return owners, false
+}
+
+// readCmdline returns the full invocation of a process, with the
+// null-separated arguments from /proc/<pid>/cmdline joined by spaces.
+func readCmdline(pid int) string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	return strings.Join(args, " ")
+}
+
+// ephemeralRange returns the range the kernel picks ephemeral ports from,
+// as set by net.ipv4.ip_local_port_range (which applies to IPv6 too).
+func ephemeralRange() (lo, hi int, ok bool) {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	lo, err1 := strconv.Atoi(fields[0])
+	hi, err2 := strconv.Atoi(fields[1])
+	return lo, hi, err1 == nil && err2 == nil
+}
+
+// ephemeralReserved returns net.ipv4.ip_local_reserved_ports, the ports
+// excluded from ephemeral allocation, as the kernel formats it ("" if none).
+func ephemeralReserved() string {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_reserved_ports")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// reservedWithin narrows a reserved-ports list in the kernel's format
+// ("8080,9000-9100") to the entries that overlap lo-hi, clipping ranges to
+// it.
+func reservedWithin(reserved string, lo, hi int) string {
+	var within []string
+	for entry := range strings.SplitSeq(reserved, ",") {
+		first, last, isRange := strings.Cut(entry, "-")
+		start, err1 := strconv.Atoi(first)
+		end, err2 := start, error(nil)
+		if isRange {
+			end, err2 = strconv.Atoi(last)
+		}
+		if err1 != nil || err2 != nil || end < lo || start > hi {
+			continue
+		}
+		start, end = max(start, lo), min(end, hi)
+		if start == end {
+			within = append(within, strconv.Itoa(start))
+		} else {
+			within = append(within, strconv.Itoa(start)+"-"+strconv.Itoa(end))
+		}
+	}
+	return strings.Join(within, ",")
+}
+
+// ownedByMe reports whether a process runs as the current effective user,
+// going by the effective UID on the Uid: line of /proc/<pid>/status.
+func ownedByMe(pid int) bool {
+	status, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return false
+	}
+	for line := range strings.Lines(string(status)) {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			// Real, effective, saved and filesystem UIDs.
+			uids := strings.Fields(rest)
+			return len(uids) > 1 && uids[1] == strconv.Itoa(os.Geteuid())
+		}
+	}
+	return false
+}
+
+// clockTicks is USER_HZ, the unit of the start time in /proc/<pid>/stat.
+// Reading it properly needs sysconf(_SC_CLK_TCK), which Go can't call
+// without cgo; Linux has used 100 on every mainstream architecture for
+// years, so assume that.
+const clockTicks = 100
+
+// processStartTime returns when a process started, from field 22 of
+// /proc/<pid>/stat (clock ticks since boot) and the uptime in /proc/uptime.
+func processStartTime(pid int) (time.Time, bool) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	// The command name in field 2 may contain spaces, so count fields from
+	// the closing parenthesis; field 3 is the first one after it.
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseUint(fields[22-3], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return time.Time{}, false
+	}
+	up, err := strconv.ParseFloat(strings.Fields(string(uptime))[0], 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	boot := time.Now().Add(-time.Duration(up * float64(time.Second)))
+	return boot.Add(time.Duration(ticks) * time.Second / clockTicks), true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+func TestParseProcAddrPort(t *testing.T) {
+	// The kernel prints addresses in host byte order; the samples below are
+	// what a little-endian machine shows.
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("samples are from a little-endian /proc/net")
+	}
+	tests := []struct {
+		input string
+		want  netip.AddrPort
+	}{
+		{"0100007F:1F90", netip.MustParseAddrPort("127.0.0.1:8080")},
+		{"00000000:0016", netip.MustParseAddrPort("0.0.0.0:22")},
+		{"0101A8C0:0050", netip.MustParseAddrPort("192.168.1.1:80")},
+		{"00000000000000000000000001000000:1F90", netip.MustParseAddrPort("[::1]:8080")},
+		{"00000000000000000000000000000000:0016", netip.MustParseAddrPort("[::]:22")},
+		{"0000000000000000FFFF00000100007F:0035", netip.MustParseAddrPort("[::ffff:127.0.0.1]:53")},
+	}
+	for _, tt := range tests {
+		got, ok := parseProcAddrPort(tt.input)
+		if !ok || got != tt.want {
+			t.Errorf("parseProcAddrPort(%q) = %v, %v, want %v", tt.input, got, ok, tt.want)
+		}
+	}
+
+	mapped, _ := parseProcAddrPort("0000000000000000FFFF00000100007F:0035")
+	if !mapped.Addr().Is4In6() || !(procSocket{Addr: mapped.Addr()}).isLoopback() {
+		t.Errorf("%v should be v4-mapped loopback", mapped.Addr())
+	}
+}
+
+func TestParseProcAddrPortMalformed(t *testing.T) {
+	for _, input := range []string{"0100007F", "0100007F:", "0100007F:XYZ", "0100007F:10000"} {
+		if got, ok := parseProcAddrPort(input); ok {
+			t.Errorf("parseProcAddrPort(%q) = %v, want failure", input, got)
+		}
+	}
+	for _, input := range []string{"0100007", "0100007G", "000000000000000000000000010000"} {
+		if addr := parseProcAddr(input); addr.IsValid() {
+			t.Errorf("parseProcAddr(%q) = %v, want the zero Addr", input, addr)
+		}
+	}
+}
+
+func TestReservedWithin(t *testing.T) {
+	tests := []struct {
+		reserved string
+		want     string
+	}{
+		{"", ""},
+		{"8080", ""},
+		{"40000", "40000"},
+		{"22,32000-33000,40000,59000-62000,65000", "32768-33000,40000,59000-60999"},
+		{"32768-60999", "32768-60999"},
+		{"60999-61000", "60999"},
+	}
+	for _, tt := range tests {
+		if got := reservedWithin(tt.reserved, 32768, 60999); got != tt.want {
+			t.Errorf("reservedWithin(%q) = %q, want %q", tt.reserved, got, tt.want)
+		}
+	}
+}
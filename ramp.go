@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rampStart is how many checks a --ramp scan runs at once to begin with.
+const rampStart = 4
+
+// rampBackoffRate is the share of failed checks in an interval above which
+// --ramp halves the concurrency instead of doubling it.
+const rampBackoffRate = 0.1
+
+// ramp gates a worker pool's concurrency for --ramp. It starts low and, once
+// per interval, doubles the limit up to the pool size, or halves it when too
+// many checks in the interval failed (timeouts and other dial errors, not
+// refusals), so a slow or rate-limited host isn't swamped from the start.
+type ramp struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	max      int
+	active   int
+	checks   int
+	failures int
+}
+
+// newRamp starts a ramp that adjusts every interval until ctx is done.
+func newRamp(ctx context.Context, max int, interval time.Duration) *ramp {
+	r := &ramp{limit: min(rampStart, max), max: max}
+	r.cond = sync.NewCond(&r.mu)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// Let any waiters through; they'll see ctx is done.
+				r.mu.Lock()
+				r.limit = r.max
+				r.cond.Broadcast()
+				r.mu.Unlock()
+				return
+			case <-ticker.C:
+				r.adjust()
+			}
+		}
+	}()
+	return r
+}
+
+// acquire waits for a free slot under the current limit.
+func (r *ramp) acquire() {
+	r.mu.Lock()
+	for r.active >= r.limit {
+		r.cond.Wait()
+	}
+	r.active++
+	r.mu.Unlock()
+}
+
+// release frees a slot and records whether the check failed.
+func (r *ramp) release(failed bool) {
+	r.mu.Lock()
+	r.active--
+	r.checks++
+	if failed {
+		r.failures++
+	}
+	r.cond.Signal()
+	r.mu.Unlock()
+}
+
+func (r *ramp) adjust() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.checks > 0 && float64(r.failures)/float64(r.checks) > rampBackoffRate {
+		r.limit = max(r.limit/2, 1)
+	} else {
+		r.limit = min(r.limit*2, r.max)
+	}
+	r.checks, r.failures = 0, 0
+	r.cond.Broadcast()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// loadReport reads a report saved with --json and checks that it is one.
+// Unknown fields are rejected so that a file from some other tool, or a
+// different shape of JSON, fails loudly instead of replaying as empty.
+func loadReport(path string) (jsonReport, error) {
+	var report struct {
+		Results *[]PortResult `json:"results"`
+		Summary scanSummary   `json:"summary"`
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jsonReport{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&report); err != nil {
+		return jsonReport{}, fmt.Errorf("%s is not a portcheck JSON report: %w", path, err)
+	}
+	if dec.More() {
+		return jsonReport{}, fmt.Errorf("%s holds more than one report (an --append log?); replay one at a time", path)
+	}
+	if report.Results == nil {
+		return jsonReport{}, fmt.Errorf("%s is not a portcheck JSON report: no results", path)
+	}
+	for i, r := range *report.Results {
+		if r.Port < 1 || r.Port > 65535 || (r.Protocol != "tcp" && r.Protocol != "udp") {
+			return jsonReport{}, fmt.Errorf("%s: result %d needs a port in 1-65535 and a protocol of tcp or udp", path, i)
+		}
+	}
+	return jsonReport{Results: *report.Results, Summary: report.Summary}, nil
+}
+
+// replayScan re-renders a saved --json report in the selected output
+// format without checking anything again.
+func replayScan(path string) {
+	report, err := loadReport(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+	// Keep the original run's header unless --header asked for a new one.
+	if report.Summary.Header != nil && !opts.header {
+		header = report.Summary.Header
+		if !machineReadable() {
+			fmt.Println(header)
+		}
+	}
+	elapsed := time.Duration(report.Summary.ElapsedMS) * time.Millisecond
+	if machineReadable() {
+		exitReport(report.Results, elapsed)
+	}
+
+	fmt.Printf("%sReplaying %d results from %s...%s\n\n", cyan, len(report.Results), path, reset)
+	// Show owners only if the original scan looked them up.
+	showPID := slices.ContainsFunc(report.Results, func(r PortResult) bool { return r.PID > 0 })
+	inUse := 0
+	for _, r := range report.Results {
+		if r.InUse {
+			inUse++
+		}
+		if r.InUse || r.Unstable {
+			printResult(r, showPID)
+		}
+	}
+	fmt.Printf("\n%s%s ports scanned in %s | %s in use, %s available%s\n",
+		cyan, formatCount(len(report.Results)), formatElapsed(elapsed), formatCount(inUse), formatCount(len(report.Results)-inUse), reset)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reservePort closes the gap between "portcheck says it's free" and "my
+// process binds it": instead of releasing the port straight away, it binds
+// it and holds the socket for opts.hold, so nothing else can take it while
+// the caller gets ready. With --fd it also prints the held socket's fd
+// number and our pid; on Linux a parent can take over that exact socket
+// with pidfd_getfd(2), or read it from /proc/<pid>/fd/<n>, and never race
+// at all.
+func reservePort(port int) {
+	sock, _, err := bindSocket(port)
+	if err != nil {
+		printResult(PortResult{Port: port, InUse: true, Protocol: protocol()}, false)
+		os.Exit(1)
+	}
+	defer sock.Close()
+
+	fmt.Printf("%s%s%s Port %s%d%s is %s%sreserved%s for %v, bind it now\n", green, symbolClosed, reset, bold, port, reset, green, bold, reset, opts.hold)
+	if opts.backlog > 0 {
+		setBacklog(sock, opts.backlog)
+	}
+	if opts.printFD {
+		printFD(sock)
+	}
+	time.Sleep(opts.hold)
+}
+
+// printFD prints a held socket's fd number and our pid, for --fd.
+func printFD(sock boundSocket) {
+	raw, err := sock.SyscallConn()
+	if err == nil {
+		raw.Control(func(fd uintptr) {
+			fmt.Printf("fd=%d pid=%d\n", fd, os.Getpid())
+		})
+	}
+}
+
+// boundSocket is a bound TCP listener or UDP socket.
+type boundSocket interface {
+	Close() error
+	SyscallConn() (syscall.RawConn, error)
+}
+
+// bindSocket binds the port over the checked protocol on the --bind
+// address, or every address, and returns the open socket along with the
+// port it got, which the kernel picks when port is 0.
+func bindSocket(port int) (boundSocket, int, error) {
+	network := protocol()
+	if !hasIPv6 {
+		network += "4"
+	}
+	addr := net.JoinHostPort(opts.bind, strconv.Itoa(port))
+
+	if protocol() == "udp" {
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		return conn.(*net.UDPConn), conn.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return listener.(*net.TCPListener), listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// setBacklog changes a listener's accept backlog and reports the backlog
+// the kernel will really use. Go listens with the system maximum and
+// offers no option for it, but Linux lets listen(2) be called again on a
+// listening socket to change the backlog. The kernel silently caps it at
+// net.core.somaxconn.
+func setBacklog(sock boundSocket, n int) {
+	raw, err := sock.SyscallConn()
+	if err == nil {
+		raw.Control(func(fd uintptr) { err = syscall.Listen(int(fd), n) })
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: could not set the listen backlog: %v%s\n", red, err, reset)
+		os.Exit(1)
+	}
+
+	effective := n
+	if data, err := os.ReadFile("/proc/sys/net/core/somaxconn"); err == nil {
+		if limit, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && limit < n {
+			effective = limit
+		}
+	}
+	if effective < n {
+		fmt.Printf("Listen backlog: %s%d%s (asked for %d, capped by net.core.somaxconn)\n", yellow, effective, reset, n)
+	} else {
+		fmt.Printf("Listen backlog: %s%d%s\n", bold, effective, reset)
+	}
+}
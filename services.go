@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// builtinService is an entry of the embedded service table.
+type builtinService struct {
+	name        string
+	description string
+}
+
+// builtinServices fills in common ports that /etc/services often lacks or
+// that a minimal container image doesn't ship at all, and describes each
+// for the info command. They apply to both TCP and UDP.
+var builtinServices = map[int]builtinService{
+	7:     {"echo", "Echo protocol"},
+	20:    {"ftp-data", "FTP data transfer"},
+	21:    {"ftp", "FTP control"},
+	22:    {"ssh", "Secure Shell"},
+	23:    {"telnet", "Telnet remote login"},
+	25:    {"smtp", "Simple Mail Transfer Protocol"},
+	53:    {"domain", "Domain Name System"},
+	67:    {"bootps", "DHCP/BOOTP server"},
+	68:    {"bootpc", "DHCP/BOOTP client"},
+	69:    {"tftp", "Trivial File Transfer Protocol"},
+	80:    {"http", "Hypertext Transfer Protocol"},
+	88:    {"kerberos", "Kerberos authentication"},
+	110:   {"pop3", "Post Office Protocol v3"},
+	111:   {"sunrpc", "ONC RPC port mapper"},
+	123:   {"ntp", "Network Time Protocol"},
+	137:   {"netbios-ns", "NetBIOS name service"},
+	138:   {"netbios-dgm", "NetBIOS datagram service"},
+	139:   {"netbios-ssn", "NetBIOS session service"},
+	143:   {"imap", "Internet Message Access Protocol"},
+	161:   {"snmp", "Simple Network Management Protocol"},
+	162:   {"snmptrap", "SNMP traps"},
+	179:   {"bgp", "Border Gateway Protocol"},
+	389:   {"ldap", "Lightweight Directory Access Protocol"},
+	443:   {"https", "HTTP over TLS"},
+	445:   {"microsoft-ds", "SMB over TCP"},
+	465:   {"submissions", "Mail submission over TLS"},
+	514:   {"syslog", "Syslog (UDP), remote shell (TCP)"},
+	515:   {"printer", "Line printer daemon"},
+	587:   {"submission", "Mail submission"},
+	631:   {"ipp", "Internet Printing Protocol (CUPS)"},
+	636:   {"ldaps", "LDAP over TLS"},
+	873:   {"rsync", "rsync daemon"},
+	993:   {"imaps", "IMAP over TLS"},
+	995:   {"pop3s", "POP3 over TLS"},
+	1080:  {"socks", "SOCKS proxy"},
+	1194:  {"openvpn", "OpenVPN"},
+	1433:  {"ms-sql-s", "Microsoft SQL Server"},
+	1521:  {"oracle", "Oracle database listener"},
+	1883:  {"mqtt", "MQTT message broker"},
+	2049:  {"nfs", "Network File System"},
+	2181:  {"zookeeper", "Apache ZooKeeper client port"},
+	2375:  {"docker", "Docker daemon API (plain)"},
+	2376:  {"docker-tls", "Docker daemon API over TLS"},
+	2379:  {"etcd-client", "etcd client API"},
+	2380:  {"etcd-server", "etcd peer traffic"},
+	3000:  {"dev-http", "Common development HTTP server (Node, Grafana)"},
+	3306:  {"mysql", "MySQL and MariaDB"},
+	3389:  {"ms-wbt-server", "Remote Desktop Protocol"},
+	4222:  {"nats", "NATS messaging"},
+	5000:  {"dev-http", "Common development HTTP server (Flask, registry)"},
+	5353:  {"mdns", "Multicast DNS"},
+	5432:  {"postgresql", "PostgreSQL database"},
+	5601:  {"kibana", "Kibana web UI"},
+	5672:  {"amqp", "AMQP message broker (RabbitMQ)"},
+	5900:  {"vnc", "VNC remote framebuffer"},
+	6379:  {"redis", "Redis key-value store"},
+	6443:  {"kube-apiserver", "Kubernetes API server"},
+	8080:  {"http-alt", "Alternate HTTP, proxies and app servers"},
+	8443:  {"https-alt", "Alternate HTTPS"},
+	8500:  {"consul", "Consul HTTP API"},
+	9000:  {"minio", "MinIO object storage, PHP-FPM"},
+	9042:  {"cassandra", "Cassandra CQL native transport"},
+	9090:  {"prometheus", "Prometheus server"},
+	9092:  {"kafka", "Apache Kafka broker"},
+	9100:  {"node-exporter", "Prometheus node exporter"},
+	9200:  {"elasticsearch", "Elasticsearch REST API"},
+	9418:  {"git", "Git protocol"},
+	10250: {"kubelet", "Kubernetes kubelet API"},
+	11211: {"memcached", "Memcached"},
+	15672: {"rabbitmq-mgmt", "RabbitMQ management UI"},
+	27017: {"mongodb", "MongoDB"},
+	51820: {"wireguard", "WireGuard VPN"},
+}
+
+// serviceKey identifies a service table entry. An empty proto matches
+// either protocol.
+type serviceKey struct {
+	proto string
+	port  int
+}
+
+var (
+	servicesOnce sync.Once
+	services     map[serviceKey]string
+	servicesErr  error
+)
+
+// loadServices builds the service table the first time it is called and
+// reports any problem with --services-file. Later sources override earlier
+// ones: the built-in map, then /etc/services, then --services-file.
+func loadServices() error {
+	servicesOnce.Do(func() { servicesErr = buildServices() })
+	return servicesErr
+}
+
+func buildServices() error {
+	services = make(map[serviceKey]string)
+	for port, entry := range builtinServices {
+		services[serviceKey{"", port}] = entry.name
+	}
+	if f, err := os.Open("/etc/services"); err == nil {
+		readEtcServices(f)
+		f.Close()
+	}
+	if opts.servicesFile != "" {
+		return readServicesFile(opts.servicesFile)
+	}
+	return nil
+}
+
+// readEtcServices reads entries like "postgresql  5432/tcp  postgres".
+func readEtcServices(f *os.File) {
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		portStr, proto, ok := strings.Cut(fields[1], "/")
+		port, err := strconv.Atoi(portStr)
+		if !ok || err != nil {
+			continue
+		}
+		services[serviceKey{proto, port}] = fields[0]
+	}
+}
+
+// readServicesFile reads a --services-file of "port name" lines. A port
+// may carry a protocol, as in "8125/udp statsd", to apply to just that one.
+func readServicesFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		portStr, proto, _ := strings.Cut(fields[0], "/")
+		port, err := parsePort(portStr)
+		if err != nil || len(fields) != 2 || (proto != "" && proto != "tcp" && proto != "udp") {
+			return fmt.Errorf("%s:%d: expected \"port name\", got %q", path, n, scanner.Text())
+		}
+		if proto == "" {
+			// Without a protocol the entry wins over /etc/services for both.
+			services[serviceKey{"tcp", port}] = fields[1]
+			services[serviceKey{"udp", port}] = fields[1]
+		} else {
+			services[serviceKey{proto, port}] = fields[1]
+		}
+	}
+	return scanner.Err()
+}
+
+// serviceName returns the conventional name of a port, or "" if none is
+// known.
+func serviceName(proto string, port int) string {
+	loadServices()
+	if name, ok := services[serviceKey{proto, port}]; ok {
+		return name
+	}
+	return services[serviceKey{"", port}]
+}
+
+// labelServices fills in the service name of every in-use result.
+func labelServices(results []PortResult) {
+	for i := range results {
+		if results[i].InUse {
+			results[i].Service = serviceName(results[i].Protocol, results[i].Port)
+		}
+	}
+}
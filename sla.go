@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Result tiers set by --sla on ports that accepted a connection.
+const (
+	tierOK   = "ok"
+	tierSlow = "slow"
+)
+
+// applySLA sets the tier of a result from --sla: "slow" when the port
+// accepted the connection but took longer than the SLA, "ok" otherwise.
+// Results that didn't connect, local ports checked by binding (such as
+// the local targets of --targets-json) and every result without --sla are
+// left without a tier.
+func applySLA(r *PortResult) {
+	timed := r.Protocol == "tcp" && (r.Host != "" || opts.connect)
+	if opts.sla <= 0 || !timed || !r.InUse || r.State == stateFiltered {
+		return
+	}
+	r.Tier = tierOK
+	if time.Duration(r.DurationMS*float64(time.Millisecond)) > opts.sla {
+		r.Tier = tierSlow
+	}
+}
+
+// slowNote describes how far a slow result missed the SLA, e.g.
+// " (312ms, SLA 200ms)".
+func slowNote(r PortResult) string {
+	took := time.Duration(r.DurationMS * float64(time.Millisecond))
+	if took >= time.Millisecond {
+		took = took.Round(time.Millisecond)
+	} else {
+		took = took.Round(time.Microsecond)
+	}
+	return fmt.Sprintf(" (%v, SLA %v)", took, opts.sla)
+}
+
+func countSlow(results []PortResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Tier == tierSlow {
+			n++
+		}
+	}
+	return n
+}
+
+// exitIfSlow exits 1 when --fail-on-slow is given and any result missed
+// the SLA.
+func exitIfSlow(results []PortResult) {
+	if opts.failOnSlow && countSlow(results) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// Constants from linux/sock_diag.h and linux/inet_diag.h.
+const (
+	netlinkSockDiag   = 4  // NETLINK_SOCK_DIAG
+	sockDiagByFamily  = 20 // SOCK_DIAG_BY_FAMILY
+	inetDiagReqLen    = 56 // sizeof(struct inet_diag_req_v2)
+	inetDiagMsgLen    = 72 // sizeof(struct inet_diag_msg)
+	inetDiagWqueueOff = 60 // offsetof(struct inet_diag_msg, idiag_wqueue)
+	inetDiagInodeOff  = 68 // offsetof(struct inet_diag_msg, idiag_inode)
+	tcpListenState    = 10 // TCP_LISTEN
+)
+
+// listenBacklogs returns the accept queue limit (the backlog given to
+// listen(2), capped by net.core.somaxconn) of each TCP listener, keyed by
+// socket inode. /proc/net/tcp only shows how full the queue is, so this
+// asks the kernel over NETLINK_SOCK_DIAG, as ss does for its Send-Q column.
+// It returns an empty map if the request fails.
+func listenBacklogs() map[string]int {
+	backlogs := make(map[string]int)
+	for _, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		dumpListeners(family, backlogs)
+	}
+	return backlogs
+}
+
+// dumpListeners adds the backlogs of one address family's TCP listeners.
+func dumpListeners(family uint8, backlogs map[string]int) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkSockDiag)
+	if err != nil {
+		return
+	}
+	defer syscall.Close(fd)
+
+	req := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqLen)
+	hdr := (*syscall.NlMsghdr)(unsafe.Pointer(&req[0]))
+	hdr.Len = uint32(len(req))
+	hdr.Type = sockDiagByFamily
+	hdr.Flags = syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP
+	body := req[syscall.NLMSG_HDRLEN:]
+	body[0] = family
+	body[1] = syscall.IPPROTO_TCP
+	binary.NativeEndian.PutUint32(body[4:], 1<<tcpListenState)
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return
+	}
+
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil || n == 0 {
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return
+		}
+		for _, m := range msgs {
+			if m.Header.Type == syscall.NLMSG_DONE || m.Header.Type == syscall.NLMSG_ERROR {
+				return
+			}
+			if len(m.Data) < inetDiagMsgLen {
+				continue
+			}
+			inode := binary.NativeEndian.Uint32(m.Data[inetDiagInodeOff:])
+			backlogs[strconv.FormatUint(uint64(inode), 10)] = int(binary.NativeEndian.Uint32(m.Data[inetDiagWqueueOff:]))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeSOCKS5 serves SOCKS5 CONNECT requests without connecting anywhere:
+// port 1 is refused, port 2 is unreachable and any other port succeeds.
+// With a user set it requires username/password authentication.
+func fakeSOCKS5(t *testing.T, user, password string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, user, password)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveSOCKS5(conn net.Conn, user, password string) {
+	defer conn.Close()
+	buf := make([]byte, 512)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	if user == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		conn.Write([]byte{5, 2})
+		// VER ULEN UNAME PLEN PASSWD
+		io.ReadFull(conn, buf[:2])
+		name := make([]byte, buf[1])
+		io.ReadFull(conn, name)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+		if string(name) != user || string(pass) != password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	// VER CMD RSV ATYP, then the address and port.
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	n := 4
+	switch buf[3] {
+	case 4:
+		n = 16
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		n = int(buf[0])
+	}
+	if _, err := io.ReadFull(conn, buf[:n+2]); err != nil {
+		return
+	}
+	reply := byte(0)
+	switch int(buf[n])<<8 | int(buf[n+1]) {
+	case 1:
+		reply = 5 // connection refused
+	case 2:
+		reply = 4 // host unreachable
+	}
+	conn.Write([]byte{5, reply, 0, 1, 127, 0, 0, 1, 0, 0})
+}
+
+func TestSOCKSProxyDial(t *testing.T) {
+	opts.portTimeout = 2 * time.Second
+	p, err := parseProxy("socks5://" + fakeSOCKS5(t, "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	conn, err := p.dial(ctx, "db.internal", 5432)
+	if err != nil {
+		t.Fatalf("open port: %v", err)
+	}
+	conn.Close()
+
+	if _, err := p.dial(ctx, "db.internal", 1); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("refused port: error = %v, want ECONNREFUSED", err)
+	}
+
+	_, err = p.dial(ctx, "10.0.0.1", 2)
+	if err == nil || errors.Is(err, syscall.ECONNREFUSED) || !strings.Contains(err.Error(), "host unreachable") {
+		t.Errorf("unreachable host: error = %v, want host unreachable", err)
+	}
+}
+
+func TestSOCKSProxyAuth(t *testing.T) {
+	opts.portTimeout = 2 * time.Second
+	addr := fakeSOCKS5(t, "alice", "s3cret")
+
+	p, _ := parseProxy("socks5://alice:s3cret@" + addr)
+	conn, err := p.dial(context.Background(), "db.internal", 5432)
+	if err != nil {
+		t.Fatalf("good credentials: %v", err)
+	}
+	conn.Close()
+
+	p, _ = parseProxy("socks5://alice:wrong@" + addr)
+	if _, err := p.dial(context.Background(), "db.internal", 5432); err == nil {
+		t.Error("bad credentials: dial succeeded")
+	}
+}
+
+func TestSOCKSProxyUnreachable(t *testing.T) {
+	opts.portTimeout = 2 * time.Second
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p, _ := parseProxy("socks5://" + addr)
+	_, err = p.dial(context.Background(), "db.internal", 5432)
+	// The proxy refusing must not read as the target being closed.
+	if err == nil || errors.Is(err, syscall.ECONNREFUSED) || !strings.HasPrefix(err.Error(), "proxy ") {
+		t.Errorf("proxy down: error = %v, want an unwrapped proxy error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// newDialer returns the dialer for a check over proto. With --source-port
+// its connections come from that local port, which is marked SO_REUSEADDR
+// so that one check can bind it while the last one's socket is still
+// closing.
+func newDialer(proto string) net.Dialer {
+	dialer := net.Dialer{Timeout: opts.portTimeout}
+	if opts.sourcePort == 0 {
+		return dialer
+	}
+	if proto == "udp" {
+		dialer.LocalAddr = &net.UDPAddr{Port: opts.sourcePort}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{Port: opts.sourcePort}
+	}
+	dialer.Control = func(_, _ string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return dialer
+}
+
+// closeFromSourcePort closes a check's connection. With --source-port it
+// resets the connection rather than closing it gracefully, so it doesn't
+// sit in TIME_WAIT for a minute, blocking the next connection from the
+// same port to the same destination.
+func closeFromSourcePort(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok && opts.sourcePort > 0 {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// checkSourcePort exits with an error if the --source-port can't be used,
+// because another socket holds it or it needs root, before any check
+// fails with the same error.
+func checkSourcePort(port int) {
+	err := tryBind(protocol(), port)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		fmt.Fprintf(os.Stderr, "%sError: cannot use source port %d: %v%s\n", red, port, err, reset)
+		os.Exit(1)
+	}
+	r := PortResult{Port: port, Protocol: protocol()}
+	findProcessByPort(&r)
+	owner := ""
+	if r.PID > 0 {
+		owner = fmt.Sprintf(" by %s (PID %d)", r.Process, r.PID)
+	}
+	fmt.Fprintf(os.Stderr, "%sError: source port %d is in use%s; pick another --source-port%s\n", red, port, owner, reset)
+	os.Exit(1)
+}
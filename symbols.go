@@ -0,0 +1,18 @@
+package main
+
+// The glyphs portcheck prints. symbolOpen and symbolClosed lead the line of
+// an in-use or open port and of an available or closed one, and can be set
+// with --symbol-open and --symbol-closed; --ascii replaces them all for
+// terminals without Unicode.
+var (
+	symbolOpen, symbolClosed, symbolUnstable, symbolUnknown = "●", "○", "◐", "◌"
+	symbolPass, symbolFail                                  = "✓", "✗"
+	treeBranch, ellipsis, histogramBar                      = "└─", "…", "█"
+)
+
+// setASCII switches every glyph to plain ASCII.
+func setASCII() {
+	symbolOpen, symbolClosed, symbolUnstable, symbolUnknown = "[X]", "[ ]", "[~]", "[?]"
+	symbolPass, symbolFail = "[ok]", "[!!]"
+	treeBranch, ellipsis, histogramBar = "`-", "...", "#"
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Target is a single host, port and protocol to check. An empty host means
+// the port is checked locally by binding it; remote ports are checked by
+// connecting, or for UDP by sending a datagram.
+type Target struct {
+	Host     string
+	Port     int
+	Protocol string
+}
+
+// String formats the target as host:port/protocol, with localhost for a
+// local check.
+func (t Target) String() string {
+	host := t.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(t.Port)) + "/" + t.Protocol
+}
+
+// targetEntry is one object of a --targets-json file. Exactly one of Port
+// and Range must be set. Protocol defaults to tcp, or to udp with --udp for
+// local checks.
+type targetEntry struct {
+	Host     string `json:"host"`
+	Port     *int   `json:"port"`
+	Range    string `json:"range"`
+	Protocol string `json:"protocol"`
+}
+
+// loadTargetsJSON reads a JSON array of targets and expands it into
+// concrete checks. Every invalid entry is reported, not just the first.
+func loadTargetsJSON(path string) ([]Target, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("%s: expected a JSON array of targets: %w", path, err)
+	}
+
+	var targets []Target
+	var invalid []string
+	for i, msg := range raw {
+		var e targetEntry
+		if err := json.Unmarshal(msg, &e); err != nil {
+			invalid = append(invalid, fmt.Sprintf("entry %d %s: %v", i, msg, err))
+			continue
+		}
+		if e.Protocol == "" {
+			e.Protocol = "tcp"
+			if e.Host == "" {
+				e.Protocol = protocol()
+			}
+		}
+		switch {
+		case e.Protocol != "tcp" && e.Protocol != "udp":
+			invalid = append(invalid, fmt.Sprintf("entry %d %s: protocol must be tcp or udp", i, msg))
+		case e.Port != nil && e.Range != "":
+			invalid = append(invalid, fmt.Sprintf("entry %d %s: give either port or range, not both", i, msg))
+		case e.Port != nil:
+			port, err := parsePort(fmt.Sprint(*e.Port))
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("entry %d %s: %v", i, msg, err))
+				continue
+			}
+			targets = append(targets, Target{e.Host, port, e.Protocol})
+		case e.Range != "":
+			start, end, err := parseRange(e.Range)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("entry %d %s: %v", i, msg, err))
+				continue
+			}
+			for port := start; port <= end; port++ {
+				targets = append(targets, Target{e.Host, port, e.Protocol})
+			}
+		default:
+			invalid = append(invalid, fmt.Sprintf("entry %d %s: missing port or range", i, msg))
+		}
+	}
+	return targets, invalid, nil
+}
+
+// dedupeTargets drops repeated host/port pairs, keeping the first of each.
+func dedupeTargets(targets []Target) []Target {
+	seen := make(map[Target]struct{}, len(targets))
+	unique := targets[:0:0]
+	for _, t := range targets {
+		if _, ok := seen[t]; !ok {
+			seen[t] = struct{}{}
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// checkTargetsFile checks every target from a --targets-json file and
+// prints each result, grouped by host.
+func checkTargetsFile(ctx context.Context, path string) {
+	targets, invalid, err := loadTargetsJSON(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+	if len(invalid) > 0 {
+		fmt.Fprintf(os.Stderr, "%sError: %d invalid entries in %s:%s\n", red, len(invalid), path, reset)
+		for _, msg := range invalid {
+			fmt.Fprintf(os.Stderr, "  %s\n", msg)
+		}
+		os.Exit(1)
+	}
+
+	if targets, err = clampTargets(targets); err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(1)
+	}
+	if opts.dedupe {
+		targets = dedupeTargets(targets)
+	}
+
+	if !machineReadable() {
+		fmt.Printf("%sChecking %d targets from %s...%s\n\n", cyan, len(targets), path, reset)
+	}
+	startTime := time.Now()
+	results := scanTargets(ctx, targets)
+	if machineReadable() {
+		exitReport(results, time.Since(startTime))
+	}
+
+	inUse := 0
+	for _, r := range results {
+		if r.InUse {
+			inUse++
+		}
+		if !opts.mergeProtocols {
+			printResult(r, false)
+		}
+	}
+	if opts.mergeProtocols {
+		printMerged(results)
+	}
+	fmt.Printf("\n%s%s targets checked in %s | %s in use or open, %s available or closed%s\n",
+		cyan, formatCount(len(results)), formatElapsed(time.Since(startTime)), formatCount(inUse), formatCount(len(results)-inUse), reset)
+	if slow := countSlow(results); slow > 0 {
+		fmt.Printf("%s%s targets were slower than the --sla of %v%s\n", yellow, formatCount(slow), opts.sla, reset)
+	}
+	exitIfSlow(results)
+}
+
+// scanTargets checks the targets concurrently and returns the results
+// sorted by host, then port, then protocol.
+//
+// With --fail-fast, the first target found closed cancels the remaining
+// checks and portcheck exits 1 naming it.
+func scanTargets(ctx context.Context, targets []Target) []PortResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var failed *PortResult
+	results := make([]PortResult, len(targets))
+	sem := make(chan struct{}, opts.concurrency)
+
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if opts.failFast && ctx.Err() != nil {
+				return
+			}
+			results[i] = checkTarget(ctx, t, false)
+			if opts.failFast && !results[i].InUse && ctx.Err() == nil {
+				failOnce.Do(func() {
+					failed = &results[i]
+					cancel()
+				})
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	if failed != nil {
+		reason := "closed"
+		if failed.Err != "" {
+			reason = failed.Err
+		}
+		fmt.Fprintf(os.Stderr, "%sError: %s is not reachable (%s); stopping (--fail-fast)%s\n", red, failed.Target(), reason, reset)
+		os.Exit(1)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Host != results[j].Host {
+			return results[i].Host < results[j].Host
+		}
+		if results[i].Port != results[j].Port {
+			return results[i].Port < results[j].Port
+		}
+		return results[i].Protocol < results[j].Protocol
+	})
+	return results
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// throttleWindow is how many of the latest checks --throttle-on-error
+	// judges the error rate over.
+	throttleWindow = 50
+	// throttleHighRate is the share of failed checks in the window above
+	// which the throttle slows down, and throttleLowRate the share below
+	// which it speeds back up.
+	throttleHighRate = 0.2
+	throttleLowRate  = 0.05
+	// throttleMinDelay and throttleMaxDelay bound the pause before each
+	// check while throttled.
+	throttleMinDelay = 50 * time.Millisecond
+	throttleMaxDelay = 2 * time.Second
+)
+
+// throttle gates a worker pool for --throttle-on-error. It runs at full
+// concurrency until too many of the last throttleWindow checks fail
+// (timeouts and other dial errors, not refusals), a sign the host is
+// rate-limiting or struggling. Then it halves the concurrency and doubles
+// a pause before each check, and once failures subside it steps back the
+// same way. The window starts over after every change so each setting is
+// judged on its own checks.
+type throttle struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	max      int
+	delay    time.Duration
+	active   int
+	window   [throttleWindow]bool
+	checks   int
+	failures int
+}
+
+func newThrottle(max int) *throttle {
+	t := &throttle{limit: max, max: max}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits for a free slot under the current limit, then for the
+// current pause.
+func (t *throttle) acquire() {
+	t.mu.Lock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+	delay := t.delay
+	t.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// release frees a slot, records whether the check failed, and adjusts the
+// rate once the window is full.
+func (t *throttle) release(failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	t.cond.Signal()
+
+	if t.window[t.checks%throttleWindow] {
+		t.failures--
+	}
+	t.window[t.checks%throttleWindow] = failed
+	if failed {
+		t.failures++
+	}
+	t.checks++
+	if t.checks < throttleWindow {
+		return
+	}
+
+	rate := float64(t.failures) / throttleWindow
+	switch {
+	case rate > throttleHighRate && (t.limit > 1 || t.delay < throttleMaxDelay):
+		t.limit = max(t.limit/2, 1)
+		t.delay = min(max(t.delay*2, throttleMinDelay), throttleMaxDelay)
+	case rate < throttleLowRate && (t.limit < t.max || t.delay > 0):
+		t.limit = min(t.limit*2, t.max)
+		if t.delay /= 2; t.delay < throttleMinDelay {
+			t.delay = 0
+		}
+	default:
+		return
+	}
+	if opts.verbose && !machineReadable() {
+		fmt.Printf("%sThrottle: %d%% of the last %d checks failed; now %d at a time, %v apart%s\n",
+			yellow, int(rate*100), throttleWindow, t.limit, t.delay, reset)
+	}
+	t.window, t.checks, t.failures = [throttleWindow]bool{}, 0, 0
+	t.cond.Broadcast()
+}
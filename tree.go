@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// procParents caches what --tree has read of each process's status, since
+// the workers of one service share most of their ancestry.
+var (
+	procParentsMu sync.Mutex
+	procParents   = map[int]procParent{}
+)
+
+type procParent struct {
+	Name string
+	PPID int
+}
+
+// readParent returns a process's name and parent PID from the Name: and
+// PPid: lines of /proc/<pid>/status.
+func readParent(pid int) (procParent, bool) {
+	procParentsMu.Lock()
+	defer procParentsMu.Unlock()
+	if p, ok := procParents[pid]; ok {
+		return p, true
+	}
+	status, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return procParent{}, false
+	}
+	var p procParent
+	for line := range strings.Lines(string(status)) {
+		if rest, ok := strings.CutPrefix(line, "Name:"); ok {
+			p.Name = strings.TrimSpace(rest)
+		} else if rest, ok := strings.CutPrefix(line, "PPid:"); ok {
+			p.PPID, _ = strconv.Atoi(strings.TrimSpace(rest))
+		}
+	}
+	procParents[pid] = p
+	return p, true
+}
+
+// ancestry returns the parents of pid, nearest first, up to and including
+// init. It stops early at a process that has exited or that the PID
+// namespace hides (PPid 0).
+func ancestry(pid int) []procOwner {
+	var chain []procOwner
+	seen := map[int]bool{pid: true}
+	for {
+		p, ok := readParent(pid)
+		if !ok || p.PPID == 0 || seen[p.PPID] {
+			return chain
+		}
+		parent, ok := readParent(p.PPID)
+		if !ok {
+			return chain
+		}
+		chain = append(chain, procOwner{PID: p.PPID, Name: parent.Name})
+		pid = p.PPID
+		seen[pid] = true
+	}
+}
+
+// printTree prints the parent chain of a port's process for --tree, one
+// indented line per ancestor.
+func printTree(pid int) {
+	for depth, p := range ancestry(pid) {
+		fmt.Printf("  %s%s %s%s%s (PID %d)\n", strings.Repeat("   ", depth), treeBranch, cyan, p.Name, reset, p.PID)
+	}
+}
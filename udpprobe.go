@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// udpProbe is an application payload that a well-known UDP service
+// answers, for --udp-probe.
+type udpProbe struct {
+	Name    string
+	Payload []byte
+	// Valid reports whether a reply looks like the service's answer.
+	Valid func(reply []byte) bool
+}
+
+// udpProbes maps ports to the probe sent to them with --udp-probe.
+var udpProbes = map[int]udpProbe{
+	// A recursive query for the root's NS records, ID 0x7063.
+	53: {"dns", []byte{
+		0x70, 0x63, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x02, 0x00, 0x01,
+	}, func(b []byte) bool {
+		return len(b) >= 12 && b[0] == 0x70 && b[1] == 0x63 && b[2]&0x80 != 0
+	}},
+	// An SNTP client request: version 3, mode 3.
+	123: {"ntp", append([]byte{0x1b}, make([]byte, 47)...), func(b []byte) bool {
+		return len(b) >= 48 && b[0]&0x07 == 4
+	}},
+	// An SNMPv2c GetRequest for sysDescr.0 with community "public".
+	161: {"snmp", []byte{
+		0x30, 0x29, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1c, 0x02, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+	}, func(b []byte) bool {
+		return len(b) > 2 && b[0] == 0x30 && bytes.Contains(b, []byte("public"))
+	}},
+}
+
+// stateOpenFiltered is the State of a remote UDP port that neither replied
+// nor was refused: an open service may simply ignore the datagram, or a
+// firewall may have dropped it.
+const stateOpenFiltered = "open|filtered"
+
+// checkRemoteUDP checks a UDP port on a remote host. UDP has no handshake,
+// so a datagram is sent and the answer decides: any reply means open, an
+// ICMP port unreachable (ECONNREFUSED) means closed, and silence is
+// open|filtered. The datagram is empty unless --udp-probe is given and the
+// port has a service payload in udpProbes, which most services need
+// before they answer at all.
+func checkRemoteUDP(ctx context.Context, host string, port int) PortResult {
+	result := PortResult{Port: port, Protocol: "udp", Host: host}
+	probe, ok := udpProbes[port]
+	if !opts.udpProbe || !ok {
+		probe = udpProbe{Name: "empty"}
+	}
+	result.Probe = probe.Name
+
+	start := time.Now()
+	reply, err := sendUDP(ctx, host, port, probe.Payload)
+	for attempt := 0; isTimeout(err) && attempt < opts.retries; attempt++ {
+		// Datagrams get lost; silence is worth another try.
+		if ctx.Err() != nil || !takeRetry() {
+			break
+		}
+		reply, err = sendUDP(ctx, host, port, probe.Payload)
+	}
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+
+	switch {
+	case err == nil:
+		result.InUse = true
+		if probe.Valid != nil && probe.Valid(reply) {
+			result.DetectedProto = probe.Name
+		}
+	case isTimeout(err):
+		result.State = stateOpenFiltered
+	case !errors.Is(err, syscall.ECONNREFUSED):
+		result.Err = err.Error()
+	}
+	return result
+}
+
+// sendUDP sends payload to a remote port and returns the first reply,
+// waiting at most --port-timeout.
+func sendUDP(ctx context.Context, host string, port int, payload []byte) ([]byte, error) {
+	dialer := newDialer("udp")
+	conn, err := dialer.DialContext(ctx, dialNetwork("udp"), net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(opts.portTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(payload); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	return buf[:n], err
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
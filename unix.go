@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// unixAcceptCon is the __SO_ACCEPTCON flag of /proc/net/unix, set on
+// sockets that are listening.
+const unixAcceptCon = 0x10000
+
+// unixTypes maps the socket type codes of /proc/net/unix to names.
+var unixTypes = map[string]string{"0001": "stream", "0002": "dgram", "0005": "seqpacket"}
+
+// unixSocket is a named Unix domain socket from /proc/net/unix. Abstract
+// sockets, which have no file and so can't be found by looking at the
+// filesystem, have a Path starting with "@"; the kernel shows their
+// leading null byte that way.
+type unixSocket struct {
+	Path      string `json:"path"`
+	Type      string `json:"type"`
+	Listening bool   `json:"listening"`
+	Inode     string `json:"inode"`
+	PID       int    `json:"pid,omitempty"`
+	Process   string `json:"process,omitempty"`
+}
+
+// Abstract reports whether the socket is in the abstract namespace.
+func (s unixSocket) Abstract() bool {
+	return strings.HasPrefix(s.Path, "@")
+}
+
+// readProcNetUnix returns the named sockets of /proc/net/unix. Unnamed
+// ones, such as the ends of a socketpair or accepted connections, are
+// skipped. A stream or seqpacket socket counts as listening when it has
+// accepted listen(2); a datagram socket when it is bound.
+func readProcNetUnix() []unixSocket {
+	file, err := os.Open("/proc/net/unix")
+	if err != nil {
+		warnProcUnreadable("/proc/net/unix", err)
+		return nil
+	}
+	defer file.Close()
+
+	var sockets []unixSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Num RefCount Protocol Flags Type St Inode Path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		typ, ok := unixTypes[fields[4]]
+		if !ok {
+			typ = fields[4]
+		}
+		sockets = append(sockets, unixSocket{
+			// A path may itself contain spaces.
+			Path:      strings.Join(fields[7:], " "),
+			Type:      typ,
+			Listening: flags&unixAcceptCon != 0 || typ == "dgram",
+			Inode:     fields[6],
+		})
+	}
+	return sockets
+}
+
+// resolveUnixOwners fills in the owning process of each socket with one
+// walk of /proc/*/fd, as resolveProcesses does for ports.
+func resolveUnixOwners(sockets []unixSocket) {
+	wanted := make(map[string]bool, len(sockets))
+	for _, s := range sockets {
+		wanted[s.Inode] = true
+	}
+	if len(wanted) == 0 {
+		return
+	}
+	owners, _ := findPIDsByInodes(wanted, 0)
+	for i := range sockets {
+		if owner, ok := owners[sockets[i].Inode]; ok {
+			sockets[i].PID, sockets[i].Process = owner.PID, owner.Name
+		}
+	}
+}
+
+// listeningUnixSockets returns the listening Unix sockets, with the same
+// path listed once even when several processes hold sockets by that name.
+func listeningUnixSockets() []unixSocket {
+	var sockets []unixSocket
+	seen := make(map[string]bool)
+	for _, s := range readProcNetUnix() {
+		if s.Listening && !seen[s.Path] {
+			seen[s.Path] = true
+			sockets = append(sockets, s)
+		}
+	}
+	resolveUnixOwners(sockets)
+	return sockets
+}
+
+// showUnixSockets lists the listening Unix sockets and their processes,
+// for status --unix.
+func showUnixSockets() {
+	sockets := listeningUnixSockets()
+	if opts.onlyProcess != "" {
+		owned := sockets[:0]
+		for _, s := range sockets {
+			if s.PID > 0 && (s.Process == opts.onlyProcess || !opts.exact && strings.Contains(s.Process, opts.onlyProcess)) {
+				owned = append(owned, s)
+			}
+		}
+		sockets = owned
+	}
+	if opts.json {
+		printUnixJSON(sockets)
+		return
+	}
+	if len(sockets) == 0 {
+		fmt.Println(yellow + "No listening Unix sockets found" + reset)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tPATH\tPID\tPROCESS")
+	for _, s := range sockets {
+		pid, process := "-", "-"
+		if s.PID > 0 {
+			pid, process = strconv.Itoa(s.PID), s.Process
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Type, s.Path, pid, process)
+	}
+	w.Flush()
+	fmt.Printf("\n%s%s listening Unix sockets%s\n", cyan, formatCount(len(sockets)), reset)
+}
+
+// checkUnixSocket reports whether anything listens on a Unix socket path,
+// or on an abstract name given as "@name", and which process it is. A
+// socket file that nothing listens on any more is called out as stale.
+// It exits 1 if something listens on the socket and 0 otherwise, so
+// scripts can test for it.
+func checkUnixSocket(path string) {
+	var found *unixSocket
+	for _, s := range listeningUnixSockets() {
+		if s.Path == path {
+			found = &s
+			break
+		}
+	}
+	if opts.json {
+		if found == nil {
+			printUnixJSON([]unixSocket{})
+			return
+		}
+		printUnixJSON([]unixSocket{*found})
+		os.Exit(1)
+	}
+	if found == nil {
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			fmt.Printf("%s%s%s Unix socket %s%s%s exists but %s%snothing is listening%s (a stale socket file)\n", yellow, symbolUnknown, reset, bold, path, reset, yellow, bold, reset)
+			return
+		}
+		fmt.Printf("%s%s%s Unix socket %s%s%s is %s%snot listening%s\n", green, symbolClosed, reset, bold, path, reset, green, bold, reset)
+		return
+	}
+	owner := fmt.Sprintf(" %s(process info unavailable - may need root)%s", yellow, reset)
+	if found.PID > 0 {
+		owner = fmt.Sprintf(" (PID: %s%d%s, Process: %s%s%s)", yellow, found.PID, reset, cyan, found.Process, reset)
+	}
+	kind := ""
+	if found.Abstract() {
+		kind = "abstract "
+	}
+	fmt.Printf("%s%s%s %sUnix socket %s%s%s is %s%slistening%s%s\n", red, symbolOpen, reset, kind, bold, path, reset, red, bold, reset, owner)
+	os.Exit(1)
+}
+
+func printUnixJSON(sockets []unixSocket) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(sockets); err != nil {
+		fmt.Fprintln(os.Stderr, red+"Error: "+err.Error()+reset)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// waitPollInterval is how often --wait-open and --wait-count re-check.
+const waitPollInterval = 250 * time.Millisecond
+
+// waitOpen polls a port until something is listening on it (or, with
+// --host, until it accepts connections), then runs the --then command if
+// one was given. If ctx ends first, under --deadline or --max-runtime, it
+// exits 1 without running the command.
+func waitOpen(ctx context.Context, port int) {
+	if !machineReadable() {
+		fmt.Printf("%sWaiting for port %d to open...%s\n", cyan, port, reset)
+	}
+	for {
+		r := checkPort(ctx, port, false)
+		if r.InUse {
+			if !machineReadable() {
+				printResult(r, false)
+			}
+			break
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(os.Stderr, "%sError: port %d did not open in time%s\n", red, port, reset)
+			os.Exit(1)
+		case <-time.After(waitPollInterval):
+		}
+	}
+
+	if opts.then != "" {
+		os.Exit(runThen(opts.then))
+	}
+}
+
+// waitCount polls a range until at least n of its ports are in use (or
+// open, with --host), then prints them and runs the --then command if one
+// was given. Each new count is reported as it changes. If ctx ends first,
+// it lists the ports that were in use on the last full pass and exits 1.
+func waitCount(ctx context.Context, ports []int, n int, showPID bool) {
+	if !machineReadable() {
+		fmt.Printf("%sWaiting for %d of %d ports to be in use...%s\n", cyan, n, len(ports), reset)
+	}
+	start := time.Now()
+	var last, inUse []PortResult
+	for first := true; ctx.Err() == nil; first = false {
+		results := scanPorts(ctx, ports, showPID)
+		if ctx.Err() != nil {
+			// A pass cut short says nothing about the ports it missed.
+			break
+		}
+		previous := len(inUse)
+		last, inUse = results, nil
+		for _, r := range results {
+			if r.InUse {
+				inUse = append(inUse, r)
+			}
+		}
+		if len(inUse) >= n {
+			printWaited(last, inUse, showPID, time.Since(start))
+			if opts.then != "" {
+				os.Exit(runThen(opts.then))
+			}
+			return
+		}
+		if (first || len(inUse) != previous) && !machineReadable() {
+			fmt.Printf("%d of %d in use\n", len(inUse), n)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(waitPollInterval):
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%sError: only %d of %d ports were in use in time%s\n", red, len(inUse), n, reset)
+	printWaited(last, inUse, showPID, time.Since(start))
+	os.Exit(1)
+}
+
+// printWaited lists the in-use ports --wait-count found. With --json,
+// --yaml, --csv or --grepable it prints the last full pass as a report
+// instead; the exit status is still waitCount's, 0 once enough ports are in
+// use.
+func printWaited(pass, inUse []PortResult, showPID bool, elapsed time.Duration) {
+	if machineReadable() {
+		writeReport(pass, elapsed)
+		return
+	}
+	for _, r := range inUse {
+		printResult(r, showPID)
+	}
+}
+
+// runThen runs a --then command through the shell with portcheck's stdio
+// and returns its exit status.
+func runThen(command string) int {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	default:
+		fmt.Fprintf(os.Stderr, "%sError: --then: %v%s\n", red, err, reset)
+		return 1
+	}
+}
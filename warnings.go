@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// warnings collects the warnings of a JSON or YAML run for the summary.
+var (
+	warningsMu sync.Mutex
+	warnings   []string
+)
+
+// warn reports a problem that doesn't stop portcheck. Text output prints
+// it on stderr unless --no-warnings is given. JSON and YAML output collect
+// it into the summary instead, so consumers of the report see it too.
+func warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if opts.json || opts.yaml {
+		warningsMu.Lock()
+		defer warningsMu.Unlock()
+		if msg = strings.ReplaceAll(msg, "\n", " "); !slices.Contains(warnings, msg) {
+			warnings = append(warnings, msg)
+		}
+		return
+	}
+	if !opts.noWarnings {
+		fmt.Fprintf(os.Stderr, "%sWarning: %s%s\n", yellow, msg, reset)
+	}
+}
+
+// collectWarnings returns the warnings raised so far along with those the
+// results imply: local checks that failed with an error other than "in
+// use", such as EACCES or EMFILE, and process lookups that stopped early.
+func collectWarnings(results []PortResult) []string {
+	failed := make(map[string]int)
+	var order []string
+	stopped := 0
+	for _, r := range results {
+		if r.Host == "" && r.Err != "" {
+			// "listen tcp :80: bind: permission denied" counts as
+			// "permission denied", whatever the port.
+			cause := strings.TrimSpace(r.Err[strings.LastIndex(r.Err, ":")+1:])
+			if failed[cause] == 0 {
+				order = append(order, cause)
+			}
+			failed[cause]++
+		}
+		if r.PIDLookupStopped {
+			stopped++
+		}
+	}
+
+	warningsMu.Lock()
+	all := slices.Clone(warnings)
+	warningsMu.Unlock()
+	for _, cause := range order {
+		all = append(all, fmt.Sprintf("%s on %d of the checked ports", cause, failed[cause]))
+	}
+	if stopped > 0 {
+		all = append(all, fmt.Sprintf("process lookup stopped early (--pid-timeout or --pid-max-scan) on %d of the checked ports", stopped))
+	}
+	return all
+}
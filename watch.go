@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchPort re-checks a port every opts.interval and prints a line each time
+// its state changes, starting with the initial state. It runs until ctx is
+// done, which without --deadline means until interrupted, or with
+// --alert-on until the first matching change.
+func watchPort(ctx context.Context, port int, showPID bool) {
+	fmt.Printf("%sWatching port %d every %v (Ctrl-C to stop)...%s\n\n", cyan, port, opts.interval, reset)
+
+	var last *PortResult
+	for ctx.Err() == nil {
+		r := checkPort(ctx, port, showPID)
+		if ctx.Err() != nil {
+			break
+		}
+		if last == nil || changed(*last, r) {
+			fmt.Printf("%s ", formatTime(time.Now()))
+			printResult(r, showPID)
+			if last != nil && alertMatches(*last, r) {
+				if opts.then != "" {
+					os.Exit(runThen(opts.then))
+				}
+				os.Exit(0)
+			}
+		}
+		last = &r
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(opts.interval):
+		}
+	}
+	if opts.alertOn != "" {
+		fmt.Fprintf(os.Stderr, "%sError: no %s change on port %d in time%s\n", red, opts.alertOn, port, reset)
+		os.Exit(1)
+	}
+}
+
+// changed reports whether a port's state differs between two checks: it
+// opened or closed, or a different process now holds it.
+func changed(prev, cur PortResult) bool {
+	return cur.InUse != prev.InUse || cur.PID != prev.PID
+}
+
+// alertMatches reports whether the change from prev to cur is one
+// --alert-on is waiting for. "any" includes a new process taking over a
+// port that stays in use.
+func alertMatches(prev, cur PortResult) bool {
+	switch opts.alertOn {
+	case "open":
+		return !prev.InUse && cur.InUse
+	case "close":
+		return prev.InUse && !cur.InUse
+	case "any":
+		return true
+	}
+	return false
+}
+
+// timeLayout maps a --time-format name to a Go time layout. Anything else,
+// including "unix" which formatTime handles itself, is passed through.
+func timeLayout(name string) string {
+	switch name {
+	case "rfc3339":
+		return "2006-01-02T15:04:05.000Z07:00"
+	}
+	return name
+}
+
+// formatTime renders an event timestamp in the --time-format layout.
+func formatTime(t time.Time) string {
+	if opts.timeFormat == "unix" {
+		return fmt.Sprintf("%.3f", float64(t.UnixMilli())/1000)
+	}
+	return t.Format(opts.timeFormat)
+}
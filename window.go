@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// inWindow reports whether a port lies within --min-port and --max-port.
+func inWindow(port int) bool {
+	return port >= opts.minPort && port <= opts.maxPort
+}
+
+// windowError describes the ports a target set loses to --min-port and
+// --max-port, for --strict.
+func windowError(dropped []int) error {
+	return fmt.Errorf("%d ports outside --min-port %d --max-port %d (first: %d)", len(dropped), opts.minPort, opts.maxPort, dropped[0])
+}
+
+// clampPortArg drops the ports of a port argument that lie outside the
+// window and returns what is left, in the same port, range or list form; a
+// range or list left with one port becomes the range "N-N".
+// With --strict any dropped port is an error instead, and so is a window
+// that leaves nothing to check.
+func clampPortArg(arg string) (string, error) {
+	ports, err := parsePortList(arg)
+	if err != nil {
+		return "", err
+	}
+	var kept, dropped []int
+	for _, port := range ports {
+		if inWindow(port) {
+			kept = append(kept, port)
+		} else {
+			dropped = append(dropped, port)
+		}
+	}
+	switch {
+	case len(dropped) == 0:
+		return arg, nil
+	case opts.strict:
+		return "", windowError(dropped)
+	case len(kept) == 0:
+		return "", fmt.Errorf("no ports of %s are within --min-port %d --max-port %d", arg, opts.minPort, opts.maxPort)
+	case len(kept) == 1:
+		// A range or list stays one, so that it is still scanned (and
+		// validated) as a range rather than checked as a single port.
+		return fmt.Sprintf("%d-%d", kept[0], kept[0]), nil
+	}
+	return formatPortList(kept), nil
+}
+
+// clampTargets drops the targets whose port lies outside the window, or
+// with --strict reports them as an error.
+func clampTargets(targets []Target) ([]Target, error) {
+	var kept []Target
+	var dropped []int
+	for _, t := range targets {
+		if inWindow(t.Port) {
+			kept = append(kept, t)
+		} else {
+			dropped = append(dropped, t.Port)
+		}
+	}
+	if len(dropped) > 0 && opts.strict {
+		return nil, windowError(dropped)
+	}
+	return kept, nil
+}
+
+// formatPortList renders ports in parsePortList's syntax, collapsing runs
+// of consecutive ports into ranges: 22,80,8000-8100.
+func formatPortList(ports []int) string {
+	var parts []string
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", ports[i], ports[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(ports[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// terminalWidth returns the width of the terminal on stdout, or 0 when
+// stdout is not a terminal.
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// lineWidth is the width --wrap cuts text output to: the value given, or
+// by default the terminal's width. 0 means no limit.
+func lineWidth() int {
+	if opts.wrap >= 0 {
+		return opts.wrap
+	}
+	return terminalWidth()
+}
+
+// ansiEscape matches the color codes printResult emits.
+var ansiEscape = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// visibleLen is the number of columns s takes up on screen, ignoring
+// color codes.
+func visibleLen(s string) int {
+	return utf8.RuneCountInString(ansiEscape.ReplaceAllString(s, ""))
+}
+
+// truncate shortens s to at most n columns, ending it with an ellipsis if
+// anything was cut. s must not contain color codes.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	runes, mark := []rune(s), []rune(ellipsis)
+	if n <= len(mark) {
+		return string(runes[:n])
+	}
+	return string(runes[:n-len(mark)]) + ellipsis
+}